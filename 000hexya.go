@@ -17,6 +17,7 @@ const MODULE_NAME string = "product"
 func init() {
 	server.RegisterModule(&server.Module{
 		Name:     MODULE_NAME,
+		PreInit:  registerRoutes,
 		PostInit: func() {},
 	})
 
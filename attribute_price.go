@@ -0,0 +1,175 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"log"
+
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
+)
+
+//`GetAmount returns the sum of the amounts added to the sale price of their template by the
+//		price extras of this set. Percentages are applied to the sale price of the template.`,
+func product_attribute_price_GetAmount(rs m.ProductAttributePriceSet) float64 {
+	var amount float64
+	for _, price := range rs.Records() {
+		if price.PriceType() == producttypes.PriceExtraPercentage {
+			amount += price.ProductTmpl().ListPrice() * price.PriceExtra() / 100
+			continue
+		}
+		amount += price.PriceExtra()
+	}
+	return amount
+}
+
+//`CheckUniquePrice checks that there is at most one price extra per template and attribute value.`,
+func product_attribute_price_CheckUniquePrice(rs m.ProductAttributePriceSet) {
+	for _, price := range rs.Records() {
+		if h.ProductAttributePrice().Search(rs.Env(),
+			q.ProductAttributePrice().ProductTmpl().Equals(price.ProductTmpl()).
+				And().Value().Equals(price.Value()).
+				And().ID().NotEquals(price.ID())).SearchCount() > 0 {
+			log.Panic(rs.T("Error: The value %s already has a price extra for the product %s.",
+				price.Value().Name(), price.ProductTmpl().Name()))
+		}
+	}
+}
+
+// combinationPriceExtras returns the fixed amount and the percentage of the sale price
+// added by the price extras of the given attribute values for the given template.
+func combinationPriceExtras(tmpl m.ProductTemplateSet, values m.ProductAttributeValueSet) (float64, float64) {
+	var fixed, percentage float64
+	if values.IsEmpty() {
+		return 0, 0
+	}
+	prices := h.ProductAttributePrice().Search(tmpl.Env(),
+		q.ProductAttributePrice().ProductTmpl().Equals(tmpl).And().Value().In(values))
+	for _, price := range prices.Records() {
+		if price.PriceType() == producttypes.PriceExtraPercentage {
+			percentage += price.PriceExtra()
+			continue
+		}
+		fixed += price.PriceExtra()
+	}
+	return fixed, percentage
+}
+
+//`GetValuePriceExtra returns the sum of the amounts added to the sale price of this
+//		template by the given attribute values.`,
+func product_template_GetValuePriceExtra(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) float64 {
+	rs.EnsureOne()
+	fixed, percentage := combinationPriceExtras(rs, values)
+	return fixed + rs.ListPrice()*percentage/100
+}
+
+//`SetValuePriceExtra sets the price extra of the given attribute values for this template.
+//		priceType is either 'fixed' or 'percentage'. If it is empty, the type of existing price
+//		extras is kept and new ones are fixed amounts. A zero fixed amount removes the price extra.`,
+func product_template_SetValuePriceExtra(rs m.ProductTemplateSet, values m.ProductAttributeValueSet, priceExtra float64, priceType string) {
+	rs.EnsureOne()
+	var entries []producttypes.AttributePriceExtra
+	for _, value := range values.Records() {
+		entries = append(entries, producttypes.AttributePriceExtra{
+			TemplateID: rs.ID(),
+			ValueID:    value.ID(),
+			PriceType:  priceType,
+			PriceExtra: priceExtra,
+		})
+	}
+	rs.SetPriceExtraMatrix(entries)
+}
+
+//`GetPriceExtraMatrix returns the price extras of the attribute values of the templates of this set,
+//		with one entry per template and value of its attribute lines, including values without price extra.`,
+func product_template_GetPriceExtraMatrix(rs m.ProductTemplateSet) []producttypes.AttributePriceExtra {
+	prices := make(map[[2]int64]m.ProductAttributePriceSet)
+	for _, price := range h.ProductAttributePrice().Search(rs.Env(),
+		q.ProductAttributePrice().ProductTmpl().In(rs)).Records() {
+		prices[[2]int64{price.ProductTmpl().ID(), price.Value().ID()}] = price
+	}
+	var res []producttypes.AttributePriceExtra
+	for _, tmpl := range rs.Records() {
+		for _, line := range tmpl.AttributeLines().Records() {
+			for _, value := range line.Values().Records() {
+				entry := producttypes.AttributePriceExtra{
+					TemplateID: tmpl.ID(),
+					ValueID:    value.ID(),
+					PriceType:  producttypes.PriceExtraFixed,
+				}
+				if price, ok := prices[[2]int64{tmpl.ID(), value.ID()}]; ok {
+					entry.PriceType = price.PriceType()
+					entry.PriceExtra = price.PriceExtra()
+					entry.Amount = price.GetAmount()
+				}
+				res = append(res, entry)
+			}
+		}
+	}
+	return res
+}
+
+//`SetPriceExtraMatrix creates, updates or removes the price extras of the templates of this set
+//		from the given entries. Entries with a zero fixed amount remove the price extra of their value.
+//		It panics if an entry refers to a template outside of this set or has an unknown price type.`,
+func product_template_SetPriceExtraMatrix(rs m.ProductTemplateSet, entries []producttypes.AttributePriceExtra) {
+	prices := make(map[[2]int64]m.ProductAttributePriceSet)
+	for _, price := range h.ProductAttributePrice().Search(rs.Env(),
+		q.ProductAttributePrice().ProductTmpl().In(rs)).Records() {
+		prices[[2]int64{price.ProductTmpl().ID(), price.Value().ID()}] = price
+	}
+	templates := make(map[int64]bool)
+	for _, id := range rs.Ids() {
+		templates[id] = true
+	}
+	toRemove := h.ProductAttributePrice().NewSet(rs.Env())
+	for _, entry := range entries {
+		if !templates[entry.TemplateID] {
+			log.Panic(rs.T("Error: The product template %d is not part of the edited templates.", entry.TemplateID))
+		}
+		key := [2]int64{entry.TemplateID, entry.ValueID}
+		price, exists := prices[key]
+		priceType := entry.PriceType
+		switch {
+		case priceType == "" && exists:
+			priceType = price.PriceType()
+		case priceType == "":
+			priceType = producttypes.PriceExtraFixed
+		case priceType != producttypes.PriceExtraFixed && priceType != producttypes.PriceExtraPercentage:
+			log.Panic(rs.T("Error: Unknown price extra type %s.", priceType))
+		}
+		switch {
+		case entry.PriceExtra == 0 && priceType == producttypes.PriceExtraFixed:
+			if exists {
+				toRemove = toRemove.Union(price)
+				delete(prices, key)
+			}
+		case exists:
+			price.Write(h.ProductAttributePrice().NewData().
+				SetPriceType(priceType).
+				SetPriceExtra(entry.PriceExtra))
+		default:
+			prices[key] = h.ProductAttributePrice().Create(rs.Env(), h.ProductAttributePrice().NewData().
+				SetProductTmpl(h.ProductTemplate().Browse(rs.Env(), []int64{entry.TemplateID})).
+				SetValue(h.ProductAttributeValue().Browse(rs.Env(), []int64{entry.ValueID})).
+				SetPriceType(priceType).
+				SetPriceExtra(entry.PriceExtra))
+		}
+	}
+	if toRemove.IsNotEmpty() {
+		toRemove.Unlink()
+	}
+}
+
+func init() {
+	h.ProductAttributePrice().NewMethod("GetAmount", product_attribute_price_GetAmount)
+	h.ProductAttributePrice().NewMethod("CheckUniquePrice", product_attribute_price_CheckUniquePrice)
+
+	h.ProductTemplate().NewMethod("GetValuePriceExtra", product_template_GetValuePriceExtra)
+	h.ProductTemplate().NewMethod("SetValuePriceExtra", product_template_SetValuePriceExtra)
+	h.ProductTemplate().NewMethod("GetPriceExtraMatrix", product_template_GetPriceExtraMatrix)
+	h.ProductTemplate().NewMethod("SetPriceExtraMatrix", product_template_SetPriceExtraMatrix)
+}
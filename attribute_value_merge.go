@@ -0,0 +1,217 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
+	"github.com/gleke/product/productvariants"
+)
+
+// duplicateVariants returns the groups of active variants of the given templates
+// that have the same attribute values.
+func duplicateVariants(templates m.ProductTemplateSet) []producttypes.DuplicateVariants {
+	var res []producttypes.DuplicateVariants
+	for _, tmpl := range templates.Sorted(func(rs1, rs2 m.ProductTemplateSet) bool {
+		return rs1.ID() < rs2.ID()
+	}).Records() {
+		groups := make(map[productvariants.Key][]int64)
+		var keys []productvariants.Key
+		for _, variant := range tmpl.ProductVariants().Sorted(func(rs1, rs2 m.ProductProductSet) bool {
+			return rs1.ID() < rs2.ID()
+		}).Records() {
+			key := productvariants.NewKey(variant.AttributeValues().Ids())
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], variant.ID())
+		}
+		for _, key := range keys {
+			if len(groups[key]) > 1 {
+				res = append(res, producttypes.DuplicateVariants{
+					TemplateID: tmpl.ID(),
+					ProductIDs: groups[key],
+				})
+			}
+		}
+	}
+	return res
+}
+
+//`MergeInto replaces the values of this set by the given target value in the variants, the
+//		attribute lines, the price extras and the exclusions of all the templates, then deletes them.
+//		If the target and a merged value both have a price extra for a template, the price extra of
+//		the target is kept. It panics if a value of this set belongs to another attribute than the target.`,
+func product_attribute_value_MergeInto(rs m.ProductAttributeValueSet, target m.ProductAttributeValueSet) {
+	target.EnsureOne()
+	values := rs.Subtract(target)
+	if values.IsEmpty() {
+		return
+	}
+	for _, value := range values.Records() {
+		if !value.Attribute().Equals(target.Attribute()) {
+			log.Panic(rs.T("Error: The value %s cannot be merged into the value %s of another attribute.",
+				value.NameGet(), target.NameGet()))
+		}
+	}
+	replace := func(set m.ProductAttributeValueSet) m.ProductAttributeValueSet {
+		return set.Subtract(values).Union(target)
+	}
+	for _, product := range h.ProductProduct().NewSet(rs.Env()).WithContext("active_test", false).Search(
+		q.ProductProduct().AttributeValues().In(values)).Records() {
+		product.SetAttributeValues(replace(product.AttributeValues()))
+	}
+	for _, line := range h.ProductAttributeLine().Search(rs.Env(),
+		q.ProductAttributeLine().Values().In(values)).Records() {
+		line.SetValues(replace(line.Values()))
+	}
+	targetPrices := make(map[int64]bool)
+	for _, price := range target.Prices().Records() {
+		targetPrices[price.ProductTmpl().ID()] = true
+	}
+	duplicatePrices := h.ProductAttributePrice().NewSet(rs.Env())
+	for _, price := range h.ProductAttributePrice().Search(rs.Env(),
+		q.ProductAttributePrice().Value().In(values)).Records() {
+		if targetPrices[price.ProductTmpl().ID()] {
+			duplicatePrices = duplicatePrices.Union(price)
+			continue
+		}
+		price.SetValue(target)
+		targetPrices[price.ProductTmpl().ID()] = true
+	}
+	if duplicatePrices.IsNotEmpty() {
+		duplicatePrices.Unlink()
+	}
+	for _, exclusion := range h.ProductAttributeExclusion().Search(rs.Env(),
+		q.ProductAttributeExclusion().Value().In(values).Or().ExcludedValues().In(values)).Records() {
+		data := h.ProductAttributeExclusion().NewData()
+		if exclusion.Value().Intersect(values).IsNotEmpty() {
+			data.SetValue(target)
+		}
+		if exclusion.ExcludedValues().Intersect(values).IsNotEmpty() {
+			data.SetExcludedValues(replace(exclusion.ExcludedValues()))
+		}
+		exclusion.Write(data)
+	}
+	values.Unlink()
+}
+
+//`FindDuplicateValues returns the groups of values of the attributes of this set that have
+//		the same name, regardless of case and in any active language. Values of each group are
+//		sorted by ID.`,
+func product_attribute_FindDuplicateValues(rs m.ProductAttributeSet) []m.ProductAttributeValueSet {
+	langs := activeLangs(rs.Env())
+	var res []m.ProductAttributeValueSet
+	for _, attr := range rs.Records() {
+		values := attr.Values().Sorted(func(rs1, rs2 m.ProductAttributeValueSet) bool {
+			return rs1.ID() < rs2.ID()
+		}).Records()
+		// groups maps the index of a value to the index of the first value of its group
+		groups := make([]int, len(values))
+		names := make([]map[string]bool, len(values))
+		for i, value := range values {
+			groups[i] = i
+			names[i] = attributeValueNames(value, langs)
+		findGroup:
+			for j := 0; j < i; j++ {
+				for name := range names[i] {
+					if names[j][name] {
+						groups[i] = groups[j]
+						break findGroup
+					}
+				}
+			}
+		}
+		duplicates := make(map[int]m.ProductAttributeValueSet)
+		for i, value := range values {
+			if _, ok := duplicates[groups[i]]; !ok {
+				duplicates[groups[i]] = h.ProductAttributeValue().NewSet(rs.Env())
+			}
+			duplicates[groups[i]] = duplicates[groups[i]].Union(value)
+		}
+		var firsts []int
+		for first, group := range duplicates {
+			if group.Len() > 1 {
+				firsts = append(firsts, first)
+			}
+		}
+		sort.Ints(firsts)
+		for _, first := range firsts {
+			res = append(res, duplicates[first])
+		}
+	}
+	return res
+}
+
+//`MergeDuplicateValues merges the duplicate values of the attributes of this set, as found by
+//		FindDuplicateValues, into the oldest value of each group. It returns the number of merged values.`,
+func product_attribute_MergeDuplicateValues(rs m.ProductAttributeSet) int {
+	var count int
+	for _, group := range rs.FindDuplicateValues() {
+		target := group.Records()[0]
+		group.Subtract(target).MergeInto(target)
+		count += group.Len() - 1
+	}
+	return count
+}
+
+//`ReplaceWith replaces the values of this set by the given target value in all the templates,
+//		as MergeInto does, and returns a report of the templates that used them and of their
+//		variants that now have the same attribute values. Nothing is changed if it panics.`,
+func product_attribute_value_ReplaceWith(rs m.ProductAttributeValueSet, target m.ProductAttributeValueSet) producttypes.ValueMergeReport {
+	target.EnsureOne()
+	values := rs.Subtract(target)
+	report := producttypes.ValueMergeReport{
+		ValueIDs: values.Ids(),
+		TargetID: target.ID(),
+	}
+	templates := h.ProductTemplate().NewSet(rs.Env())
+	for _, line := range h.ProductAttributeLine().Search(rs.Env(),
+		q.ProductAttributeLine().Values().In(values)).Records() {
+		templates = templates.Union(line.ProductTmpl())
+	}
+	for _, product := range h.ProductProduct().NewSet(rs.Env()).WithContext("active_test", false).Search(
+		q.ProductProduct().AttributeValues().In(values)).Records() {
+		templates = templates.Union(product.ProductTmpl())
+	}
+	values.MergeInto(target)
+	report.TemplateIDs = templates.Ids()
+	sort.Slice(report.TemplateIDs, func(i, j int) bool { return report.TemplateIDs[i] < report.TemplateIDs[j] })
+	report.Duplicates = duplicateVariants(templates)
+	return report
+}
+
+//`Rename renames this value in all the templates. If another value of the same attribute
+//		already has this name, regardless of case and in any active language, this value is
+//		replaced by the other one as ReplaceWith does. It returns the report of the replacement,
+//		which has no duplicates if the value has only been renamed.`,
+func product_attribute_value_Rename(rs m.ProductAttributeValueSet, name string) producttypes.ValueMergeReport {
+	rs.EnsureOne()
+	langs := activeLangs(rs.Env())
+	lowerName := strings.ToLower(strings.TrimSpace(name))
+	others := h.ProductAttributeValue().Search(rs.Env(),
+		q.ProductAttributeValue().Attribute().Equals(rs.Attribute()).And().ID().NotEquals(rs.ID()))
+	for _, other := range others.Records() {
+		if attributeValueNames(other, langs)[lowerName] {
+			return rs.ReplaceWith(other)
+		}
+	}
+	rs.SetName(name)
+	return producttypes.ValueMergeReport{TargetID: rs.ID()}
+}
+
+func init() {
+	h.ProductAttributeValue().NewMethod("MergeInto", product_attribute_value_MergeInto)
+	h.ProductAttributeValue().NewMethod("ReplaceWith", product_attribute_value_ReplaceWith)
+	h.ProductAttributeValue().NewMethod("Rename", product_attribute_value_Rename)
+
+	h.ProductAttribute().NewMethod("FindDuplicateValues", product_attribute_FindDuplicateValues)
+	h.ProductAttribute().NewMethod("MergeDuplicateValues", product_attribute_MergeDuplicateValues)
+}
@@ -0,0 +1,492 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/hexya/src/models/types"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
+)
+
+var fields_BarcodeNomenclature = map[string]models.FieldDefinition{
+	"Name": fields.Char{String: "Barcode Nomenclature", Required: true,
+		Help: "An internal identification of the barcode nomenclature"},
+	"Rules": fields.One2Many{String: "Rules", RelationModel: h.BarcodeRule(), ReverseFK: "Nomenclature",
+		JSON: "rule_ids", Copy: true, Help: "The list of barcode rules"},
+}
+
+var fields_BarcodeRule = map[string]models.FieldDefinition{
+	"Name": fields.Char{String: "Rule Name", Required: true,
+		Help: "An internal identification for this barcode nomenclature rule"},
+	"Nomenclature": fields.Many2One{String: "Barcode Nomenclature", RelationModel: h.BarcodeNomenclature(),
+		Required: true, OnDelete: models.Cascade},
+	"Sequence": fields.Integer{
+		Help: "Used to order rules such that rules with a smaller sequence match first"},
+	"Type": fields.Selection{Selection: types.Selection{
+		"product":   "Unit Product",
+		"packaging": "Packaging",
+		"weight":    "Weighted Product",
+		"price":     "Priced Product",
+	}, Required: true, Default: models.DefaultValue("product"),
+		Help: "The kind of barcode recognized by this rule"},
+	"Encoding": fields.Selection{Selection: types.Selection{
+		"any":    "Any",
+		"ean13":  "EAN-13",
+		"ean8":   "EAN-8",
+		"upca":   "UPC-A",
+		"gtin14": "GTIN-14",
+	}, Required: true, Default: models.DefaultValue("any"),
+		Help: `This rule will apply only if the barcode is encoded with the specified encoding,
+i.e. has the right length and a valid check digit. 'Any' accepts any barcode.`},
+	"Pattern": fields.Char{String: "Barcode Pattern", Required: true, Default: models.DefaultValue("."),
+		Constraint: h.BarcodeRule().Methods().CheckPattern(),
+		Help: `The barcode matching pattern. Digits must match exactly and dots match any character.
+The part between braces holds an embedded value, with 'N' for integer digits and 'D' for decimal digits.
+The pattern only needs to match the beginning of the barcode.`},
+}
+
+// barcodeEncodingLengths gives the length of the barcodes of each encoding with a GS1 check digit
+var barcodeEncodingLengths = map[string]int{
+	"ean13":  13,
+	"ean8":   8,
+	"upca":   12,
+	"gtin14": 14,
+}
+
+// barcodeCheckDigit returns the GS1 check digit of the given barcode, whose
+// last digit is the check digit and is ignored. It returns -1 if the barcode is
+// not made of digits only.
+func barcodeCheckDigit(barcode string) int {
+	if len(barcode) < 2 {
+		return -1
+	}
+	var sum int
+	payload := barcode[:len(barcode)-1]
+	for i := len(payload) - 1; i >= 0; i-- {
+		digit := int(payload[i] - '0')
+		if digit < 0 || digit > 9 {
+			return -1
+		}
+		if (len(payload)-1-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return (10 - sum%10) % 10
+}
+
+// barcodeHasValidCheckDigit returns true if the last digit of the given barcode is its GS1 check digit
+func barcodeHasValidCheckDigit(barcode string) bool {
+	check := barcodeCheckDigit(barcode)
+	return check >= 0 && int(barcode[len(barcode)-1]-'0') == check
+}
+
+// barcodeWithCheckDigit returns the given barcode with its last digit replaced by the GS1 check digit
+func barcodeWithCheckDigit(barcode string) string {
+	check := barcodeCheckDigit(barcode)
+	if check < 0 {
+		return barcode
+	}
+	return barcode[:len(barcode)-1] + strconv.Itoa(check)
+}
+
+// barcodeMatchesEncoding returns true if the given barcode is valid for the given encoding.
+// The "any" encoding accepts any non empty barcode.
+func barcodeMatchesEncoding(barcode, encoding string) bool {
+	length, ok := barcodeEncodingLengths[encoding]
+	if !ok {
+		return barcode != ""
+	}
+	return len(barcode) == length && barcodeHasValidCheckDigit(barcode)
+}
+
+// matchBarcodePattern checks whether the given barcode is valid for the given encoding and
+// starts with the given pattern. If it does, it returns the base barcode, i.e. the barcode
+// with the embedded value replaced by zeros and a recomputed check digit, and the embedded
+// value. If the pattern has no embedded value, the base barcode is the barcode itself.
+func matchBarcodePattern(pattern, encoding, barcode string) (string, float64, bool) {
+	if !barcodeMatchesEncoding(barcode, encoding) {
+		return "", 0, false
+	}
+	start := strings.Index(pattern, "{")
+	end := strings.Index(pattern, "}")
+	var valuePattern string
+	flatPattern := pattern
+	if start >= 0 && end > start {
+		valuePattern = pattern[start+1 : end]
+		flatPattern = pattern[:start] + valuePattern + pattern[end+1:]
+	}
+	if len(flatPattern) > len(barcode) {
+		return "", 0, false
+	}
+	for i := 0; i < len(flatPattern); i++ {
+		if valuePattern != "" && i >= start && i < start+len(valuePattern) {
+			if barcode[i] < '0' || barcode[i] > '9' {
+				return "", 0, false
+			}
+			continue
+		}
+		if flatPattern[i] != '.' && flatPattern[i] != barcode[i] {
+			return "", 0, false
+		}
+	}
+	if valuePattern == "" {
+		return barcode, 0, true
+	}
+	valueDigits := barcode[start : start+len(valuePattern)]
+	value, _ := strconv.ParseFloat(valueDigits, 64)
+	value /= math.Pow10(strings.Count(valuePattern, "D"))
+	base := barcode[:start] + strings.Repeat("0", len(valuePattern)) + barcode[start+len(valuePattern):]
+	if _, ok := barcodeEncodingLengths[encoding]; ok {
+		base = barcodeWithCheckDigit(base)
+	}
+	return base, value, true
+}
+
+//`MatchBarcode returns the first rule of this nomenclature that matches the given barcode,
+//		or an empty set if no rule matches or if this set is empty.`,
+func barcode_nomenclature_MatchBarcode(rs m.BarcodeNomenclatureSet, barcode string) m.BarcodeRuleSet {
+	if rs.IsEmpty() {
+		return h.BarcodeRule().NewSet(rs.Env())
+	}
+	rs.EnsureOne()
+	rules := h.BarcodeRule().Search(rs.Env(), q.BarcodeRule().Nomenclature().Equals(rs)).OrderBy("Sequence", "ID")
+	for _, rule := range rules.Records() {
+		if _, _, ok := matchBarcodePattern(rule.Pattern(), rule.Encoding(), barcode); ok {
+			return rule
+		}
+	}
+	return h.BarcodeRule().NewSet(rs.Env())
+}
+
+//`GetDefault returns the default barcode nomenclature`,
+func barcode_nomenclature_GetDefault(rs m.BarcodeNomenclatureSet) m.BarcodeNomenclatureSet {
+	return h.BarcodeNomenclature().Search(rs.Env(),
+		q.BarcodeNomenclature().HexyaExternalID().Equals("product_barcode_nomenclature_default"))
+}
+
+//`CheckPattern checks that the pattern of this rule is well formed`,
+func barcode_rule_CheckPattern(rs m.BarcodeRuleSet) {
+	for _, rule := range rs.Records() {
+		pattern := rule.Pattern()
+		start := strings.Index(pattern, "{")
+		end := strings.Index(pattern, "}")
+		if strings.Count(pattern, "{") > 1 || strings.Count(pattern, "}") > 1 || (start < 0) != (end < 0) || end < start {
+			log.Panic(rs.T("Error: The barcode pattern %s has unbalanced braces.", pattern))
+		}
+		if start < 0 {
+			continue
+		}
+		valuePattern := pattern[start+1 : end]
+		if valuePattern == "" || strings.TrimLeft(strings.TrimLeft(valuePattern, "N"), "D") != "" {
+			log.Panic(rs.T("Error: The embedded value of the barcode pattern %s must be made of 'N' followed by 'D'.", pattern))
+		}
+	}
+}
+
+//`GetBarcodeNomenclature returns the nomenclature used to validate and parse the barcodes of this product`,
+func product_product_GetBarcodeNomenclature(rs m.ProductProductSet) m.BarcodeNomenclatureSet {
+	company := rs.Company()
+	if company.IsEmpty() {
+		company = h.Company().NewSet(rs.Env()).CompanyDefaultGet()
+	}
+	return company.GetBarcodeNomenclature()
+}
+
+// barcodeExists returns true if the given barcode is used by any product, even archived,
+// or by any packaging.
+func barcodeExists(env models.Environment, barcode string) bool {
+	products := h.ProductProduct().NewSet(env).WithContext("active_test", false).
+		Search(q.ProductProduct().Barcode().Equals(barcode))
+	return products.SearchCount() > 0 ||
+		h.ProductPackaging().Search(env, q.ProductPackaging().Barcode().Equals(barcode)).SearchCount() > 0
+}
+
+// barcodeUsedElsewhere returns true if the given barcode is used by an active product other than
+// the given product or by a packaging of an active product other than the given packaging. Only
+// records of the given company or shared between companies are considered.
+func barcodeUsedElsewhere(env models.Environment, barcode string, company m.CompanySet,
+	product m.ProductProductSet, packaging m.ProductPackagingSet) bool {
+	productCond := q.ProductProduct().Barcode().Equals(barcode).And().ID().NotEquals(product.ID())
+	packagingCond := q.ProductPackaging().Barcode().Equals(barcode).And().ID().NotEquals(packaging.ID())
+	if company.IsNotEmpty() {
+		productCond = productCond.AndCond(q.ProductProduct().Company().Equals(company).Or().Company().IsNull())
+		packagingCond = packagingCond.And().ProductTmplFilteredOn(
+			q.ProductTemplate().Company().Equals(company).Or().Company().IsNull())
+	}
+	packagingCond = packagingCond.And().ProductTmplFilteredOn(q.ProductTemplate().Active().Equals(true))
+	return h.ProductProduct().Search(env, productCond).SearchCount() > 0 ||
+		h.ProductPackaging().Search(env, packagingCond).SearchCount() > 0
+}
+
+// barcodeCompany returns the given company, or the default company if it is empty
+func barcodeCompany(env models.Environment, company m.CompanySet) m.CompanySet {
+	if company.IsEmpty() {
+		return h.Company().NewSet(env).CompanyDefaultGet()
+	}
+	return company
+}
+
+//`CheckBarcode checks that the barcodes of the products of this set are not used by another
+//		active product or packaging of the same company and, if their company validates barcodes,
+//		that they match a product rule of its barcode nomenclature. Archived products are not checked.`,
+func product_product_CheckBarcode(rs m.ProductProductSet) {
+	for _, product := range rs.Records() {
+		if product.Barcode() == "" || !product.Active() {
+			continue
+		}
+		company := barcodeCompany(rs.Env(), product.Company())
+		if company.StrictBarcodes() {
+			rule := company.GetBarcodeNomenclature().MatchBarcode(product.Barcode())
+			if rule.IsEmpty() || rule.Type() == "packaging" {
+				log.Panic(rs.T("Error: The barcode %s of product %s is not valid.", product.Barcode(), product.Name()))
+			}
+		}
+		if barcodeUsedElsewhere(rs.Env(), product.Barcode(), product.Company(), product, h.ProductPackaging().NewSet(rs.Env())) {
+			log.Panic(rs.T("Error: The barcode %s is already used by another product or packaging.", product.Barcode()))
+		}
+	}
+}
+
+//`CheckBarcode checks that the barcodes of the packagings of this set are not used by another
+//		active product or packaging of the same company and, if their company validates barcodes,
+//		that they match a product or packaging rule of its barcode nomenclature.`,
+func product_packaging_CheckBarcode(rs m.ProductPackagingSet) {
+	for _, pack := range rs.Records() {
+		if pack.Barcode() == "" {
+			continue
+		}
+		company := barcodeCompany(rs.Env(), pack.ProductTmpl().Company())
+		if company.StrictBarcodes() {
+			rule := company.GetBarcodeNomenclature().MatchBarcode(pack.Barcode())
+			if rule.IsEmpty() || (rule.Type() != "packaging" && rule.Type() != "product") {
+				log.Panic(rs.T("Error: The barcode %s of packaging %s is not valid.", pack.Barcode(), pack.Name()))
+			}
+		}
+		if barcodeUsedElsewhere(rs.Env(), pack.Barcode(), pack.ProductTmpl().Company(), h.ProductProduct().NewSet(rs.Env()), pack) {
+			log.Panic(rs.T("Error: The barcode %s is already used by another product or packaging.", pack.Barcode()))
+		}
+	}
+}
+
+//`CheckBarcode checks the barcodes of the variants and packagings of the templates of this set.
+//		It is run when a template is reactivated or moved to another company.`,
+func product_template_CheckBarcode(rs m.ProductTemplateSet) {
+	for _, tmpl := range rs.Records() {
+		tmpl.ProductVariants().CheckBarcode()
+		if tmpl.Active() {
+			tmpl.Packagings().CheckBarcode()
+		}
+	}
+}
+
+//`GenerateBarcode assigns a generated EAN-13 barcode to each product of this set that has none`,
+func product_product_GenerateBarcode(rs m.ProductProductSet) {
+	for _, product := range rs.Records() {
+		if product.Barcode() != "" {
+			continue
+		}
+		company := product.Company()
+		if company.IsEmpty() {
+			company = h.Company().NewSet(rs.Env()).CompanyDefaultGet()
+		}
+		product.SetBarcode(company.NextBarcode())
+	}
+}
+
+//`GenerateBarcode assigns a generated EAN-13 barcode to each active variant of the templates
+//		of this set that has none`,
+func product_template_GenerateBarcode(rs m.ProductTemplateSet) {
+	for _, tmpl := range rs.Records() {
+		tmpl.ProductVariants().GenerateBarcode()
+	}
+}
+
+// A barcodeHolder is a record holding a barcode, used by ValidateAllBarcodes
+type barcodeHolder struct {
+	issue     producttypes.BarcodeIssue
+	companyID int64
+}
+
+//`ValidateAllBarcodes checks the barcodes of all active products and packagings of the database
+//		and returns the list of the invalid or duplicate ones.`,
+func product_product_ValidateAllBarcodes(rs m.ProductProductSet) []producttypes.BarcodeIssue {
+	var (
+		res           []producttypes.BarcodeIssue
+		holders       []barcodeHolder
+		byCode        = make(map[string][]int)
+		nomenclatures = make(map[int64]m.BarcodeNomenclatureSet)
+	)
+	nomenclature := func(company m.CompanySet) m.BarcodeNomenclatureSet {
+		if company.IsEmpty() {
+			company = h.Company().NewSet(rs.Env()).CompanyDefaultGet()
+		}
+		if _, ok := nomenclatures[company.ID()]; !ok {
+			nomenclatures[company.ID()] = company.GetBarcodeNomenclature()
+		}
+		return nomenclatures[company.ID()]
+	}
+	addHolder := func(issue producttypes.BarcodeIssue, company m.CompanySet, validTypes ...string) {
+		rule := nomenclature(company).MatchBarcode(issue.Barcode)
+		var valid bool
+		if rule.IsNotEmpty() {
+			for _, typ := range validTypes {
+				valid = valid || rule.Type() == typ
+			}
+		}
+		if !valid {
+			issue.Problem = producttypes.BarcodeInvalid
+			res = append(res, issue)
+		}
+		byCode[issue.Barcode] = append(byCode[issue.Barcode], len(holders))
+		holders = append(holders, barcodeHolder{issue: issue, companyID: company.ID()})
+	}
+	products := h.ProductProduct().Search(rs.Env(), q.ProductProduct().Barcode().IsNotNull().And().Barcode().NotEquals(""))
+	for _, product := range products.Records() {
+		addHolder(producttypes.BarcodeIssue{
+			Model:    "ProductProduct",
+			RecordID: product.ID(),
+			Name:     product.DisplayName(),
+			Barcode:  product.Barcode(),
+		}, product.Company(), "product", "weight", "price")
+	}
+	packagings := h.ProductPackaging().Search(rs.Env(), q.ProductPackaging().Barcode().IsNotNull().
+		And().Barcode().NotEquals("").
+		And().ProductTmplFilteredOn(q.ProductTemplate().Active().Equals(true)))
+	for _, pack := range packagings.Records() {
+		addHolder(producttypes.BarcodeIssue{
+			Model:    "ProductPackaging",
+			RecordID: pack.ID(),
+			Name:     pack.Name(),
+			Barcode:  pack.Barcode(),
+		}, pack.ProductTmpl().Company(), "packaging", "product")
+	}
+	for _, holder := range holders {
+		for _, other := range byCode[holder.issue.Barcode] {
+			otherHolder := holders[other]
+			if otherHolder.issue.Model == holder.issue.Model && otherHolder.issue.RecordID == holder.issue.RecordID {
+				continue
+			}
+			if holder.companyID == 0 || otherHolder.companyID == 0 || holder.companyID == otherHolder.companyID {
+				issue := holder.issue
+				issue.Problem = producttypes.BarcodeDuplicate
+				res = append(res, issue)
+				break
+			}
+		}
+	}
+	return res
+}
+
+//`LookupBarcode returns what the given scanned barcode designates. The barcode is searched in turn
+//		among product variant barcodes, packaging barcodes, GS1 barcodes with an embedded weight
+//		or price and vendor product codes. Vendor codes are restricted to the partner given as
+//		'partner_id' in the context, if any.`,
+func product_product_LookupBarcode(rs m.ProductProductSet, barcode string) producttypes.BarcodeLookup {
+	barcode = strings.TrimSpace(barcode)
+	res := producttypes.BarcodeLookup{Barcode: barcode}
+	if barcode == "" {
+		return res
+	}
+	product := h.ProductProduct().Search(rs.Env(), q.ProductProduct().Barcode().Equals(barcode)).Limit(1)
+	if product.IsNotEmpty() {
+		res.Type = producttypes.BarcodeProduct
+		res.ProductID = product.ID()
+		res.TemplateID = product.ProductTmpl().ID()
+		res.Quantity = 1
+		return res
+	}
+	packaging := h.ProductPackaging().Search(rs.Env(), q.ProductPackaging().Barcode().Equals(barcode)).Limit(1)
+	if packaging.IsNotEmpty() {
+		res.Type = producttypes.BarcodePackaging
+		res.PackagingID = packaging.ID()
+		res.TemplateID = packaging.ProductTmpl().ID()
+		res.Quantity = packaging.ProductQty()
+		switch {
+		case packaging.Product().IsNotEmpty():
+			res.ProductID = packaging.Product().ID()
+		case packaging.ProductTmpl().ProductVariants().Len() == 1:
+			res.ProductID = packaging.ProductTmpl().ProductVariant().ID()
+		}
+		return res
+	}
+	rules := h.BarcodeRule().Search(rs.Env(),
+		q.BarcodeRule().Nomenclature().Equals(rs.GetBarcodeNomenclature()).
+			And().Type().In([]string{"weight", "price"})).OrderBy("Sequence", "ID")
+	for _, rule := range rules.Records() {
+		base, value, ok := matchBarcodePattern(rule.Pattern(), rule.Encoding(), barcode)
+		if !ok {
+			continue
+		}
+		product := h.ProductProduct().Search(rs.Env(), q.ProductProduct().Barcode().Equals(base)).Limit(1)
+		if product.IsEmpty() {
+			continue
+		}
+		res.Type = producttypes.BarcodeMatchType(rule.Type())
+		res.ProductID = product.ID()
+		res.TemplateID = product.ProductTmpl().ID()
+		res.Quantity = 1
+		switch res.Type {
+		case producttypes.BarcodeWeight:
+			res.Weight = value
+			kgUom := h.ProductUom().NewSet(rs.Env()).GetReferenceWeightUom()
+			if product.Uom().Category().Equals(kgUom.Category()) {
+				res.Quantity = kgUom.ComputeQuantity(value, product.Uom(), false)
+			}
+		case producttypes.BarcodePrice:
+			res.Price = value
+		}
+		return res
+	}
+	sellerCond := q.ProductSupplierinfo().ProductCode().Equals(barcode)
+	if rs.Env().Context().HasKey("partner_id") {
+		partner := h.Partner().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("partner_id")})
+		sellerCond = sellerCond.And().Name().Equals(partner)
+	}
+	seller := h.ProductSupplierinfo().Search(rs.Env(), sellerCond).Limit(1)
+	if seller.IsNotEmpty() {
+		res.Type = producttypes.BarcodeVendorCode
+		res.SupplierinfoID = seller.ID()
+		res.TemplateID = seller.ProductTmpl().ID()
+		res.Quantity = 1
+		switch {
+		case seller.Product().IsNotEmpty():
+			res.ProductID = seller.Product().ID()
+			res.TemplateID = seller.Product().ProductTmpl().ID()
+		case seller.ProductTmpl().ProductVariants().Len() == 1:
+			res.ProductID = seller.ProductTmpl().ProductVariant().ID()
+		}
+	}
+	return res
+}
+
+func init() {
+	models.NewModel("BarcodeNomenclature")
+	h.BarcodeNomenclature().AddFields(fields_BarcodeNomenclature)
+	h.BarcodeNomenclature().NewMethod("MatchBarcode", barcode_nomenclature_MatchBarcode)
+	h.BarcodeNomenclature().NewMethod("GetDefault", barcode_nomenclature_GetDefault)
+
+	models.NewModel("BarcodeRule")
+	h.BarcodeRule().SetDefaultOrder("Sequence", "ID")
+	h.BarcodeRule().AddFields(fields_BarcodeRule)
+	h.BarcodeRule().NewMethod("CheckPattern", barcode_rule_CheckPattern)
+
+	h.ProductProduct().NewMethod("GetBarcodeNomenclature", product_product_GetBarcodeNomenclature)
+	h.ProductProduct().NewMethod("CheckBarcode", product_product_CheckBarcode)
+	h.ProductProduct().NewMethod("ValidateAllBarcodes", product_product_ValidateAllBarcodes)
+	h.ProductProduct().NewMethod("LookupBarcode", product_product_LookupBarcode)
+	h.ProductProduct().NewMethod("GenerateBarcode", product_product_GenerateBarcode)
+	h.ProductTemplate().NewMethod("CheckBarcode", product_template_CheckBarcode)
+	h.ProductTemplate().NewMethod("GenerateBarcode", product_template_GenerateBarcode)
+	h.ProductPackaging().NewMethod("CheckBarcode", product_packaging_CheckBarcode)
+}
@@ -0,0 +1,246 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/product/producttypes"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBarcodeHelpers(t *testing.T) {
+	Convey("Testing barcode helpers", t, func() {
+		So(barcodeCheckDigit("4006381333931"), ShouldEqual, 1)
+		So(barcodeHasValidCheckDigit("4006381333931"), ShouldBeTrue)
+		So(barcodeHasValidCheckDigit("4006381333932"), ShouldBeFalse)
+		So(barcodeHasValidCheckDigit("73513537"), ShouldBeTrue)
+		So(barcodeWithCheckDigit("2100001012340"), ShouldEqual, "2100001012342")
+		base, value, ok := matchBarcodePattern("21.....{NNDDD}", "ean13", "2100001012342")
+		So(ok, ShouldBeTrue)
+		So(base, ShouldEqual, "2100001000004")
+		So(value, ShouldEqual, 1.234)
+		_, _, ok = matchBarcodePattern("23.....{NNNDD}", "ean13", "2100001012342")
+		So(ok, ShouldBeFalse)
+		_, _, ok = matchBarcodePattern(".", "ean13", "4006381333932")
+		So(ok, ShouldBeFalse)
+		So(barcodeMatchesEncoding("14006381333938", "gtin14"), ShouldBeTrue)
+		So(barcodeMatchesEncoding("036000291452", "upca"), ShouldBeTrue)
+		So(barcodeMatchesEncoding("4006381333931", "ean8"), ShouldBeFalse)
+		base, _, ok = matchBarcodePattern("ABC", "any", "ABC-123")
+		So(ok, ShouldBeTrue)
+		So(base, ShouldEqual, "ABC-123")
+	})
+}
+
+func TestBarcodeLookup(t *testing.T) {
+	Convey("Testing barcode lookup", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			uomUnit := h.ProductUom().NewSet(env).GetRecord("product_product_uom_unit")
+			uomKgm := h.ProductUom().NewSet(env).GetRecord("product_product_uom_kgm")
+			asusTec := h.Partner().NewSet(env).GetRecord("base_res_partner_1")
+			juice := h.ProductProduct().Create(env, h.ProductProduct().NewData().
+				SetName("Orange Juice").
+				SetUom(uomUnit).
+				SetUomPo(uomUnit).
+				SetBarcode("4006381333931"))
+			cheese := h.ProductProduct().Create(env, h.ProductProduct().NewData().
+				SetName("Cheese").
+				SetUom(uomKgm).
+				SetUomPo(uomKgm).
+				SetBarcode("2100001000004"))
+			ham := h.ProductProduct().Create(env, h.ProductProduct().NewData().
+				SetName("Ham").
+				SetUom(uomUnit).
+				SetUomPo(uomUnit).
+				SetBarcode("2300002000007"))
+			juiceCase := h.ProductPackaging().Create(env, h.ProductPackaging().NewData().
+				SetName("Case").
+				SetProductTmpl(juice.ProductTmpl()).
+				SetQty(12).
+				SetBarcode("14006381333938"))
+			h.ProductSupplierinfo().Create(env, h.ProductSupplierinfo().NewData().
+				SetName(asusTec).
+				SetProductTmpl(juice.ProductTmpl()).
+				SetProductCode("ASU-OJ-1"))
+			lookup := h.ProductProduct().NewSet(env)
+			Convey("Product barcode", func() {
+				res := lookup.LookupBarcode("4006381333931")
+				So(res.Type, ShouldEqual, producttypes.BarcodeProduct)
+				So(res.ProductID, ShouldEqual, juice.ID())
+				So(res.Quantity, ShouldEqual, 1)
+			})
+			Convey("Packaging barcode", func() {
+				res := lookup.LookupBarcode("14006381333938")
+				So(res.Type, ShouldEqual, producttypes.BarcodePackaging)
+				So(res.ProductID, ShouldEqual, juice.ID())
+				So(res.PackagingID, ShouldEqual, juiceCase.ID())
+				So(res.Quantity, ShouldEqual, 12)
+			})
+			Convey("Embedded weight", func() {
+				res := lookup.LookupBarcode("2100001012342")
+				So(res.Type, ShouldEqual, producttypes.BarcodeWeight)
+				So(res.ProductID, ShouldEqual, cheese.ID())
+				So(res.Weight, ShouldEqual, 1.234)
+				So(res.Quantity, ShouldAlmostEqual, 1.234, 0.0001)
+			})
+			Convey("Embedded price", func() {
+				res := lookup.LookupBarcode(barcodeWithCheckDigit("2300002012500"))
+				So(res.Type, ShouldEqual, producttypes.BarcodePrice)
+				So(res.ProductID, ShouldEqual, ham.ID())
+				So(res.Price, ShouldEqual, 12.5)
+			})
+			Convey("Vendor code", func() {
+				res := lookup.LookupBarcode("ASU-OJ-1")
+				So(res.Type, ShouldEqual, producttypes.BarcodeVendorCode)
+				So(res.ProductID, ShouldEqual, juice.ID())
+			})
+			Convey("Unknown barcode", func() {
+				res := lookup.LookupBarcode("0000000000000")
+				So(res.Type, ShouldEqual, producttypes.BarcodeNoMatch)
+			})
+		}), ShouldBeNil)
+	})
+}
+
+func TestBarcodeValidation(t *testing.T) {
+	Convey("Testing barcode validation", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			uomUnit := h.ProductUom().NewSet(env).GetRecord("product_product_uom_unit")
+			newProduct := func(name, barcode string) m.ProductProductSet {
+				return h.ProductProduct().Create(env, h.ProductProduct().NewData().
+					SetName(name).
+					SetUom(uomUnit).
+					SetUomPo(uomUnit).
+					SetBarcode(barcode))
+			}
+			company := h.Company().NewSet(env).CompanyDefaultGet()
+			juice := newProduct("Orange Juice", "4006381333931")
+			Convey("Barcodes are validated with the default company settings", func() {
+				So(company.StrictBarcodes(), ShouldBeTrue)
+				So(func() { newProduct("Apple Juice", "4006381333932") }, ShouldPanic)
+			})
+			Convey("Any barcode is accepted if the company does not validate barcodes", func() {
+				company.SetStrictBarcodes(false)
+				So(func() { newProduct("Apple Juice", "ABC-123") }, ShouldNotPanic)
+				So(func() { newProduct("Lemon Juice", "4006381333931") }, ShouldPanic)
+			})
+			Convey("Barcodes with a wrong check digit are refused", func() {
+				So(func() { newProduct("Apple Juice", "4006381333932") }, ShouldPanic)
+				So(func() { juice.SetBarcode("40063813") }, ShouldPanic)
+			})
+			Convey("UPC-A and EAN-8 barcodes are accepted", func() {
+				So(func() { newProduct("Apple Juice", "036000291452") }, ShouldNotPanic)
+				So(func() { newProduct("Lemon Juice", "73513537") }, ShouldNotPanic)
+			})
+			Convey("GTIN-14 barcodes are only accepted on packagings", func() {
+				So(func() { newProduct("Apple Juice", "14006381333938") }, ShouldPanic)
+				So(func() {
+					h.ProductPackaging().Create(env, h.ProductPackaging().NewData().
+						SetName("Case").
+						SetProductTmpl(juice.ProductTmpl()).
+						SetQty(12).
+						SetBarcode("14006381333938"))
+				}, ShouldNotPanic)
+			})
+			Convey("Barcodes must be unique among active products and packagings", func() {
+				So(func() { newProduct("Apple Juice", "4006381333931") }, ShouldPanic)
+				So(func() {
+					h.ProductPackaging().Create(env, h.ProductPackaging().NewData().
+						SetName("Unit").
+						SetProductTmpl(juice.ProductTmpl()).
+						SetQty(1).
+						SetBarcode("4006381333931"))
+				}, ShouldPanic)
+			})
+			Convey("Archived products may share a barcode but cannot be reactivated", func() {
+				juice.SetActive(false)
+				So(func() { newProduct("Apple Juice", "4006381333931") }, ShouldNotPanic)
+				So(func() { juice.SetActive(true) }, ShouldPanic)
+			})
+			Convey("Nomenclatures can be customized", func() {
+				So(func() { newProduct("Apple Juice", "ABC-123") }, ShouldPanic)
+				h.BarcodeRule().Create(env, h.BarcodeRule().NewData().
+					SetName("Internal Codes").
+					SetNomenclature(h.BarcodeNomenclature().NewSet(env).GetDefault()).
+					SetType("product").
+					SetEncoding("any").
+					SetPattern("ABC"))
+				So(func() { newProduct("Apple Juice", "ABC-123") }, ShouldNotPanic)
+				So(func() {
+					h.BarcodeRule().Create(env, h.BarcodeRule().NewData().
+						SetName("Wrong Rule").
+						SetNomenclature(h.BarcodeNomenclature().NewSet(env).GetDefault()).
+						SetPattern("22{DDNN"))
+				}, ShouldPanic)
+			})
+			Convey("Batch validation reports invalid and duplicate barcodes", func() {
+				apple := newProduct("Apple Juice", "036000291452")
+				lemon := newProduct("Lemon Juice", "73513537")
+				// Duplicates can only come from data written before barcodes were checked
+				env.Cr().Execute("UPDATE product_product SET barcode = ? WHERE id = ?", "4006381333931", lemon.ID())
+				lemon.Collection().InvalidateCache()
+				h.BarcodeRule().NewSet(env).GetRecord("product_barcode_rule_upca").Unlink()
+				issues := h.ProductProduct().NewSet(env).ValidateAllBarcodes()
+				So(issues, ShouldHaveLength, 3)
+				problems := make(map[int64]producttypes.BarcodeProblem)
+				for _, issue := range issues {
+					So(issue.Model, ShouldEqual, "ProductProduct")
+					problems[issue.RecordID] = issue.Problem
+				}
+				So(problems[apple.ID()], ShouldEqual, producttypes.BarcodeInvalid)
+				So(problems[juice.ID()], ShouldEqual, producttypes.BarcodeDuplicate)
+				So(problems[lemon.ID()], ShouldEqual, producttypes.BarcodeDuplicate)
+			})
+		}), ShouldBeNil)
+	})
+}
+
+func TestBarcodeGenerator(t *testing.T) {
+	Convey("Testing barcode generation", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			company := h.Company().NewSet(env).CompanyDefaultGet()
+			Convey("Internal barcodes are generated in the 200 range", func() {
+				ptd.product1.GenerateBarcode()
+				So(ptd.product1.Barcode(), ShouldEqual, barcodeWithCheckDigit("2000000000010"))
+				So(company.BarcodeSequence().IsNotEmpty(), ShouldBeTrue)
+			})
+			Convey("Products with a barcode are left untouched", func() {
+				ptd.product2.SetBarcode("4006381333931")
+				ptd.product2.GenerateBarcode()
+				So(ptd.product2.Barcode(), ShouldEqual, "4006381333931")
+			})
+			Convey("Barcodes of archived products are not reused", func() {
+				ptd.product3.SetBarcode(barcodeWithCheckDigit("2000000000010"))
+				ptd.product3.SetActive(false)
+				ptd.product1.GenerateBarcode()
+				So(ptd.product1.Barcode(), ShouldEqual, barcodeWithCheckDigit("2000000000020"))
+			})
+			Convey("Company GS1 prefix is used when set", func() {
+				So(func() { company.SetBarcodePrefix("12AB") }, ShouldPanic)
+				company.SetBarcodePrefix("3760123")
+				ptd.product1.GenerateBarcode()
+				So(ptd.product1.Barcode(), ShouldEqual, barcodeWithCheckDigit("3760123000010"))
+			})
+			Convey("The sequence starts again when the prefix changes", func() {
+				ptd.product1.GenerateBarcode()
+				company.SetBarcodePrefix("3760123")
+				ptd.product2.GenerateBarcode()
+				So(ptd.product2.Barcode(), ShouldEqual, barcodeWithCheckDigit("3760123000010"))
+			})
+			Convey("Variants of a template are generated in bulk", func() {
+				ptd.template7.GenerateBarcode()
+				So(ptd.product71.Barcode(), ShouldNotBeEmpty)
+				So(ptd.product72.Barcode(), ShouldNotBeEmpty)
+				So(ptd.product71.Barcode(), ShouldNotEqual, ptd.product72.Barcode())
+				So(barcodeHasValidCheckDigit(ptd.product71.Barcode()), ShouldBeTrue)
+			})
+		}), ShouldBeNil)
+	})
+}
@@ -4,6 +4,9 @@
 package product
 
 import (
+	"log"
+	"strings"
+
 	"github.com/gleke/hexya/src/models"
 	"github.com/gleke/hexya/src/models/fields"
 	"github.com/gleke/pool/h"
@@ -14,6 +17,120 @@ import (
 var fields_Company = map[string]models.FieldDefinition{
 	"DefaultPriceList": fields.Many2One{RelationModel: h.ProductPricelist(),
 		Help: "Default Price list for partners of this company"},
+	"WeightUom": fields.Many2One{String: "Weight Unit of Measure", RelationModel: h.ProductUom(),
+		Filter: q.ProductUom().CategoryFilteredOn(
+			q.ProductUomCategory().HexyaExternalID().Equals("product_product_uom_categ_kgm")),
+		Help: `Unit of measure in which product weights are entered and displayed for this company.
+Weights are always stored in kg. Keep empty to use kg.`},
+	"VolumeUom": fields.Many2One{String: "Volume Unit of Measure", RelationModel: h.ProductUom(),
+		Filter: q.ProductUom().CategoryFilteredOn(
+			q.ProductUomCategory().HexyaExternalID().Equals("product_product_uom_categ_vol")),
+		Help: `Unit of measure in which product volumes are entered and displayed for this company.
+Volumes are always stored in m³. Keep empty to use m³.`},
+	"BarcodeNomenclature": fields.Many2One{RelationModel: h.BarcodeNomenclature(),
+		Default: func(env models.Environment) interface{} {
+			return h.BarcodeNomenclature().NewSet(env).GetDefault()
+		},
+		Help: "Nomenclature used to validate and parse the product barcodes of this company"},
+	"StrictBarcodes": fields.Boolean{String: "Validate Barcodes", Default: models.DefaultValue(true),
+		Help: `If set, product and packaging barcodes must match a rule of the barcode nomenclature.
+Barcodes must be unique among active products and packagings in any case.`},
+	"UniqueDefaultCodes": fields.Boolean{String: "Unique Internal References", Default: models.DefaultValue(true),
+		Help: "If set, the internal reference of an active product cannot be used by another active product of this company."},
+	"BarcodePrefix": fields.Char{String: "GS1 Company Prefix",
+		Constraint: h.Company().Methods().CheckBarcodePrefix(),
+		Help: `GS1 company prefix used to generate the EAN-13 barcodes of products without manufacturer barcode.
+Keep empty to generate internal barcodes in the restricted circulation range, starting with 200.`},
+	"BarcodeSequence": fields.Many2One{RelationModel: h.Sequence(), NoCopy: true,
+		Help: "Sequence giving the item reference of the generated barcodes"},
+	"VariantLimit": fields.Integer{String: "Variants Limit", Default: models.DefaultValue(1000),
+		Help: `Maximum number of variants generated at once for a product of this company.
+Set 0 for no limit.`},
+}
+
+// internalBarcodePrefix is the prefix of the barcodes generated for companies without GS1 company
+// prefix. It belongs to the GS1 restricted circulation range and does not collide with the
+// embedded weight (21) and price (23) rules of the default nomenclature.
+const internalBarcodePrefix = "200"
+
+//`GetWeightUom returns the unit of measure in which this company enters and displays weights`,
+func company_GetWeightUom(rs m.CompanySet) m.ProductUomSet {
+	if rs.WeightUom().IsNotEmpty() {
+		return rs.WeightUom()
+	}
+	return h.ProductUom().NewSet(rs.Env()).GetReferenceWeightUom()
+}
+
+//`GetVolumeUom returns the unit of measure in which this company enters and displays volumes`,
+func company_GetVolumeUom(rs m.CompanySet) m.ProductUomSet {
+	if rs.VolumeUom().IsNotEmpty() {
+		return rs.VolumeUom()
+	}
+	return h.ProductUom().NewSet(rs.Env()).GetReferenceVolumeUom()
+}
+
+//`GetBarcodeNomenclature returns the barcode nomenclature of this company`,
+func company_GetBarcodeNomenclature(rs m.CompanySet) m.BarcodeNomenclatureSet {
+	if rs.BarcodeNomenclature().IsNotEmpty() {
+		return rs.BarcodeNomenclature()
+	}
+	return h.BarcodeNomenclature().NewSet(rs.Env()).GetDefault()
+}
+
+//`CheckBarcodePrefix checks that the GS1 company prefix is made of 3 to 11 digits`,
+func company_CheckBarcodePrefix(rs m.CompanySet) {
+	for _, company := range rs.Records() {
+		prefix := company.BarcodePrefix()
+		if prefix == "" {
+			continue
+		}
+		if len(prefix) < 3 || len(prefix) > 11 || strings.Trim(prefix, "0123456789") != "" {
+			log.Panic(rs.T("Error: The GS1 company prefix must be made of 3 to 11 digits."))
+		}
+	}
+}
+
+//`GetBarcodePrefix returns the prefix of the barcodes generated for this company`,
+func company_GetBarcodePrefix(rs m.CompanySet) string {
+	if rs.BarcodePrefix() != "" {
+		return rs.BarcodePrefix()
+	}
+	return internalBarcodePrefix
+}
+
+//`GetBarcodeSequence returns the sequence of the generated barcodes of this company,
+//		creating it if necessary.`,
+func company_GetBarcodeSequence(rs m.CompanySet) m.SequenceSet {
+	rs.EnsureOne()
+	// Users generating barcodes are not expected to manage sequences nor companies
+	company := rs.Sudo()
+	if company.BarcodeSequence().IsEmpty() {
+		company.SetBarcodeSequence(h.Sequence().NewSet(rs.Env()).Sudo().Create(h.Sequence().NewData().
+			SetName(rs.T("Product Barcodes - %s", rs.Name())).
+			SetCode("product.barcode").
+			SetCompany(rs)))
+	}
+	return company.BarcodeSequence()
+}
+
+//`NextBarcode returns a new EAN-13 barcode made of the barcode prefix of this company, the next
+//		number of its barcode sequence and a check digit. Barcodes already used by a product, even
+//		archived, or by a packaging are skipped.`,
+func company_NextBarcode(rs m.CompanySet) string {
+	rs.EnsureOne()
+	prefix := rs.GetBarcodePrefix()
+	sequence := rs.GetBarcodeSequence()
+	refLength := 12 - len(prefix)
+	for {
+		ref := sequence.Next()
+		if len(ref) > refLength {
+			log.Panic(rs.T("Error: There are no more barcodes available with prefix %s.", prefix))
+		}
+		barcode := barcodeWithCheckDigit(prefix + strings.Repeat("0", refLength-len(ref)) + ref + "0")
+		if !barcodeExists(rs.Env(), barcode) {
+			return barcode
+		}
+	}
 }
 
 func company_Create(rs m.CompanySet, vals m.CompanyData) m.CompanySet {
@@ -30,6 +147,14 @@ func company_Create(rs m.CompanySet, vals m.CompanyData) m.CompanySet {
 }
 
 func company_Write(rs m.CompanySet, vals m.CompanyData) bool {
+	if vals.HasBarcodePrefix() {
+		// Generated numbers only need to be unique for a given prefix
+		for _, company := range rs.Records() {
+			if company.BarcodePrefix() != vals.BarcodePrefix() && company.BarcodeSequence().IsNotEmpty() {
+				company.Sudo().BarcodeSequence().SetNumberNextActual(1)
+			}
+		}
+	}
 	// When we modify the currency of the company, we reflect the change on the list0 pricelist, if
 	// that pricelist is not used by another company. Otherwise, we create a new pricelist for the
 	// given currency.
@@ -54,6 +179,13 @@ func company_Write(rs m.CompanySet, vals m.CompanyData) bool {
 func init() {
 
 	h.Company().AddFields(fields_Company)
+	h.Company().NewMethod("GetWeightUom", company_GetWeightUom)
+	h.Company().NewMethod("GetVolumeUom", company_GetVolumeUom)
+	h.Company().NewMethod("GetBarcodeNomenclature", company_GetBarcodeNomenclature)
+	h.Company().NewMethod("CheckBarcodePrefix", company_CheckBarcodePrefix)
+	h.Company().NewMethod("GetBarcodePrefix", company_GetBarcodePrefix)
+	h.Company().NewMethod("GetBarcodeSequence", company_GetBarcodeSequence)
+	h.Company().NewMethod("NextBarcode", company_NextBarcode)
 	h.Company().Methods().Create().Extend(company_Create)
 	h.Company().Methods().Write().Extend(company_Write)
 }
@@ -0,0 +1,225 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"log"
+
+	"github.com/gleke/decimalPrecision"
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/hexya/src/models/types/dates"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+)
+
+var fields_ProductKitLine = map[string]models.FieldDefinition{
+	"KitTmpl": fields.Many2One{String: "Kit", RelationModel: h.ProductTemplate(),
+		OnDelete: models.Cascade, Required: true, Index: true,
+		Constraint: h.ProductKitLine().Methods().CheckComponent()},
+	"Sequence": fields.Integer{Default: models.DefaultValue(10)},
+	"Product": fields.Many2One{String: "Component", RelationModel: h.ProductProduct(),
+		OnDelete: models.Restrict, Required: true,
+		OnChange:   h.ProductKitLine().Methods().OnchangeProduct(),
+		Constraint: h.ProductKitLine().Methods().CheckComponent()},
+	"Quantity": fields.Float{Required: true, Default: models.DefaultValue(1.0),
+		Digits: decimalPrecision.GetPrecision("Product Unit of Measure")},
+	"Uom": fields.Many2One{String: "Unit of Measure", RelationModel: h.ProductUom(),
+		Constraint: h.ProductKitLine().Methods().CheckComponent(),
+		Help:       "Unit of measure of the quantity. The unit of measure of the component is used if empty."},
+}
+
+var fields_ProductTemplateKit = map[string]models.FieldDefinition{
+	"IsKit": fields.Boolean{String: "Is a Kit",
+		Help: "If set, this product is sold as a bundle of the components listed in its kit lines"},
+	"KitLines": fields.One2Many{String: "Kit Components", RelationModel: h.ProductKitLine(),
+		ReverseFK: "KitTmpl", JSON: "kit_line_ids", Copy: true},
+	"KitListPrice": fields.Boolean{String: "Sale Price from Components",
+		Help: "If set, the sale price of this kit is the sum of the sale prices of its components"},
+	"KitCost": fields.Float{String: "Components Cost",
+		Compute: h.ProductTemplate().Methods().ComputeKitPrices(),
+		Digits:  decimalPrecision.GetPrecision("Product Price")},
+	"KitPrice": fields.Float{String: "Components Sale Price",
+		Compute: h.ProductTemplate().Methods().ComputeKitPrices(),
+		Digits:  decimalPrecision.GetPrecision("Product Price")},
+}
+
+//`OnchangeProduct sets the unit of measure of this line to the one of its component`,
+func product_kit_line_OnchangeProduct(rs m.ProductKitLineSet) m.ProductKitLineData {
+	res := h.ProductKitLine().NewData()
+	if rs.Product().IsNotEmpty() {
+		res.SetUom(rs.Product().Uom())
+	}
+	return res
+}
+
+//`CheckComponent checks that the unit of measure of the lines of this set is of the same
+//		category as the one of their component, and that no kit contains itself.`,
+func product_kit_line_CheckComponent(rs m.ProductKitLineSet) {
+	for _, line := range rs.Records() {
+		if line.Uom().IsNotEmpty() && !line.Uom().Category().Equals(line.Product().Uom().Category()) {
+			log.Panic(rs.T("Error: The unit of measure %s is not compatible with the component %s.",
+				line.Uom().Name(), line.Product().Name()))
+		}
+		if line.KitTmpl().KitContains(line.KitTmpl()) {
+			log.Panic(rs.T("Error: The kit %s cannot contain itself.", line.KitTmpl().Name()))
+		}
+	}
+}
+
+//`ComponentQuantity returns the quantity of the component of this line in its unit of measure`,
+func product_kit_line_ComponentQuantity(rs m.ProductKitLineSet) float64 {
+	rs.EnsureOne()
+	if rs.Uom().IsEmpty() {
+		return rs.Quantity()
+	}
+	return rs.Uom().ComputeQuantity(rs.Quantity(), rs.Product().Uom(), false)
+}
+
+//`KitContains returns true if the given template is a component of this kit or of its sub-kits`,
+func product_template_KitContains(rs m.ProductTemplateSet, tmpl m.ProductTemplateSet) bool {
+	visited := make(map[int64]bool)
+	var contains func(kit m.ProductTemplateSet) bool
+	contains = func(kit m.ProductTemplateSet) bool {
+		if visited[kit.ID()] {
+			return false
+		}
+		visited[kit.ID()] = true
+		for _, line := range kit.KitLines().Records() {
+			component := line.Product().ProductTmpl()
+			if component.Equals(tmpl) || contains(component) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, kit := range rs.Records() {
+		if contains(kit) {
+			return true
+		}
+	}
+	return false
+}
+
+//`ComputeKitPrices computes the cost and the sale price of this kit from its components`,
+func product_template_ComputeKitPrices(rs m.ProductTemplateSet) m.ProductTemplateData {
+	res := h.ProductTemplate().NewData()
+	if !rs.IsKit() {
+		return res
+	}
+	return res.
+		SetKitCost(rs.GetKitPrice(q.ProductProduct().StandardPrice())).
+		SetKitPrice(rs.GetKitPrice(q.ProductProduct().ListPrice()))
+}
+
+//`GetKitPrice returns the sum of the prices of the components of this kit for one unit of the kit.
+//		priceType is the price field of the components, as in ProductProduct's PriceCompute.`,
+func product_template_GetKitPrice(rs m.ProductTemplateSet, priceType models.FieldName) float64 {
+	rs.EnsureOne()
+	var price float64
+	for _, line := range rs.KitLines().Records() {
+		component := line.Product()
+		unitPrice := component.PriceCompute(priceType, h.ProductUom().NewSet(rs.Env()),
+			rs.Currency(), rs.Company())
+		price += unitPrice * line.ComponentQuantity()
+	}
+	return price
+}
+
+//`GetKitPricelistPrice returns the sum of the prices of the components of this kit given by the
+//		given pricelist, for one unit of the kit when the given quantity of kits is bought. The
+//		price is expressed in the currency of the pricelist.`,
+func product_template_GetKitPricelistPrice(rs m.ProductTemplateSet, pricelist m.ProductPricelistSet,
+	quantity float64, partner m.PartnerSet, date dates.Date) float64 {
+
+	rs.EnsureOne()
+	var price float64
+	for _, line := range rs.KitLines().Records() {
+		componentQty := line.ComponentQuantity()
+		unitPrice, rule := pricelist.ComputePriceRule(line.Product(), quantity*componentQty,
+			partner, date, line.Product().Uom())
+		if rule.IsEmpty() {
+			// Prices of components matching no rule are in the currency of the component
+			unitPrice = line.Product().Currency().Compute(unitPrice, pricelist.Currency(), false)
+		}
+		price += unitPrice * componentQty
+	}
+	return price
+}
+
+//`UpdateKitCost sets the cost of the variants of the kits of this set to the cost of their components`,
+func product_template_UpdateKitCost(rs m.ProductTemplateSet) {
+	for _, kit := range rs.Records() {
+		if !kit.IsKit() {
+			continue
+		}
+		cost := kit.GetKitPrice(q.ProductProduct().StandardPrice())
+		variants := kit.ProductVariants().Filtered(func(r m.ProductProductSet) bool {
+			return r.StandardPrice() != cost
+		})
+		if variants.IsNotEmpty() {
+			variants.SetStandardPrice(cost)
+		}
+	}
+}
+
+func product_template_kit_Write(rs m.ProductTemplateSet, vals m.ProductTemplateData) bool {
+	res := rs.Super().Write(vals)
+	if vals.HasIsKit() || vals.HasKitLines() {
+		rs.UpdateKitCost()
+	}
+	return res
+}
+
+func product_product_kit_Write(rs m.ProductProductSet, vals m.ProductProductData) bool {
+	res := rs.Super().Write(vals)
+	if vals.HasStandardPrice() {
+		// Update the kits containing these products, which in turn update the kits containing them
+		h.ProductKitLine().Search(rs.Env(), q.ProductKitLine().Product().In(rs)).KitTmpl().UpdateKitCost()
+	}
+	return res
+}
+
+func product_kit_line_Create(rs m.ProductKitLineSet, data m.ProductKitLineData) m.ProductKitLineSet {
+	line := rs.Super().Create(data)
+	line.KitTmpl().UpdateKitCost()
+	return line
+}
+
+func product_kit_line_Write(rs m.ProductKitLineSet, vals m.ProductKitLineData) bool {
+	kits := rs.KitTmpl()
+	res := rs.Super().Write(vals)
+	kits.Union(rs.KitTmpl()).UpdateKitCost()
+	return res
+}
+
+func product_kit_line_Unlink(rs m.ProductKitLineSet) int64 {
+	kits := rs.KitTmpl()
+	res := rs.Super().Unlink()
+	kits.UpdateKitCost()
+	return res
+}
+
+func init() {
+	models.NewModel("ProductKitLine")
+	h.ProductKitLine().SetDefaultOrder("Sequence", "ID")
+	h.ProductKitLine().AddFields(fields_ProductKitLine)
+	h.ProductKitLine().NewMethod("OnchangeProduct", product_kit_line_OnchangeProduct)
+	h.ProductKitLine().NewMethod("CheckComponent", product_kit_line_CheckComponent)
+	h.ProductKitLine().NewMethod("ComponentQuantity", product_kit_line_ComponentQuantity)
+	h.ProductKitLine().Methods().Create().Extend(product_kit_line_Create)
+	h.ProductKitLine().Methods().Write().Extend(product_kit_line_Write)
+	h.ProductKitLine().Methods().Unlink().Extend(product_kit_line_Unlink)
+
+	h.ProductTemplate().AddFields(fields_ProductTemplateKit)
+	h.ProductTemplate().NewMethod("KitContains", product_template_KitContains)
+	h.ProductTemplate().NewMethod("ComputeKitPrices", product_template_ComputeKitPrices)
+	h.ProductTemplate().NewMethod("GetKitPrice", product_template_GetKitPrice)
+	h.ProductTemplate().NewMethod("GetKitPricelistPrice", product_template_GetKitPricelistPrice)
+	h.ProductTemplate().NewMethod("UpdateKitCost", product_template_UpdateKitCost)
+	h.ProductTemplate().Methods().Write().Extend(product_template_kit_Write)
+
+	h.ProductProduct().Methods().Write().Extend(product_product_kit_Write)
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/hexya/src/models/types"
+	"github.com/gleke/hexya/src/models/types/dates"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/product/productlabels"
+)
+
+var fields_ProductLabelLayout = map[string]models.FieldDefinition{
+	"Name": fields.Char{String: "Layout Name", Required: true, Translate: true},
+	"Format": fields.Selection{Selection: types.Selection{
+		"pdf": "PDF Label Sheets",
+		"zpl": "ZPL Thermal Printer",
+	}, Required: true, Default: models.DefaultValue("pdf")},
+	"Symbology": fields.Selection{String: "Barcode Type", Selection: types.Selection{
+		"auto":    "EAN-13 when possible, Code 128 otherwise",
+		"ean13":   "EAN-13",
+		"code128": "Code 128",
+	}, Required: true, Default: models.DefaultValue("auto"),
+		Help: "Barcodes that are not valid EAN-13 are always printed in Code 128."},
+	"PageWidth": fields.Float{String: "Page Width (mm)", Required: true, Default: models.DefaultValue(210.0),
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout(),
+		Help:       "Width of the label sheet, or of the roll for thermal printers"},
+	"PageHeight": fields.Float{String: "Page Height (mm)", Default: models.DefaultValue(297.0),
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout(),
+		Help:       "Height of the label sheet. Not used for thermal printers."},
+	"Columns": fields.Integer{Required: true, Default: models.DefaultValue(1),
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout()},
+	"Rows": fields.Integer{Default: models.DefaultValue(1),
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout(),
+		Help:       "Number of rows of labels on a sheet. Not used for thermal printers."},
+	"LabelWidth": fields.Float{String: "Label Width (mm)", Required: true, Default: models.DefaultValue(63.5),
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout()},
+	"LabelHeight": fields.Float{String: "Label Height (mm)", Required: true, Default: models.DefaultValue(38.1),
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout()},
+	"MarginTop": fields.Float{String: "Top Margin (mm)",
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout()},
+	"MarginLeft": fields.Float{String: "Left Margin (mm)",
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout()},
+	"HorizontalSpacing": fields.Float{String: "Horizontal Spacing (mm)",
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout()},
+	"VerticalSpacing": fields.Float{String: "Vertical Spacing (mm)",
+		Constraint: h.ProductLabelLayout().Methods().CheckLayout()},
+	"Dpi": fields.Integer{String: "Printer Resolution (dpi)", Default: models.DefaultValue(203),
+		Help: "Resolution of the thermal printer in dots per inch"},
+	"ShowReference":  fields.Boolean{String: "Print Internal Reference", Default: models.DefaultValue(true)},
+	"ShowAttributes": fields.Boolean{String: "Print Variant Attributes", Default: models.DefaultValue(true)},
+	"ShowPrice":      fields.Boolean{String: "Print Price", Default: models.DefaultValue(true)},
+}
+
+//`GetLayout returns the productlabels layout of this label layout`,
+func product_label_layout_GetLayout(rs m.ProductLabelLayoutSet) productlabels.Layout {
+	rs.EnsureOne()
+	return productlabels.Layout{
+		Format:            productlabels.Format(rs.Format()),
+		PageWidth:         rs.PageWidth(),
+		PageHeight:        rs.PageHeight(),
+		Columns:           int(rs.Columns()),
+		Rows:              int(rs.Rows()),
+		LabelWidth:        rs.LabelWidth(),
+		LabelHeight:       rs.LabelHeight(),
+		MarginTop:         rs.MarginTop(),
+		MarginLeft:        rs.MarginLeft(),
+		HorizontalSpacing: rs.HorizontalSpacing(),
+		VerticalSpacing:   rs.VerticalSpacing(),
+		Symbology:         productlabels.Symbology(rs.Symbology()),
+		DPI:               int(rs.Dpi()),
+	}
+}
+
+//`CheckLayout checks that the labels of this layout fit on the page`,
+func product_label_layout_CheckLayout(rs m.ProductLabelLayoutSet) {
+	for _, layout := range rs.Records() {
+		if err := layout.GetLayout().Validate(); err != nil {
+			log.Panic(rs.T("Error: The label layout %s is not valid: %s", layout.Name(), err.Error()))
+		}
+	}
+}
+
+//`Render returns the given labels rendered with this layout, as a PDF document
+//		or as ZPL commands depending on the layout format.`,
+func product_label_layout_Render(rs m.ProductLabelLayoutSet, labels []productlabels.Label) []byte {
+	rs.EnsureOne()
+	res, err := productlabels.Render(rs.GetLayout(), labels)
+	if err != nil {
+		log.Panic(rs.T("Error: The label layout %s is not valid: %s", rs.Name(), err.Error()))
+	}
+	return res
+}
+
+// formatLabelPrice returns the given amount formatted with the given currency
+func formatLabelPrice(amount float64, currency m.CurrencySet) string {
+	if currency.IsEmpty() {
+		return fmt.Sprintf("%.2f", amount)
+	}
+	price := fmt.Sprintf("%.*f", currency.DecimalPlaces(), currency.Round(amount))
+	if currency.Position() == "before" {
+		return fmt.Sprintf("%s %s", currency.Symbol(), price)
+	}
+	return fmt.Sprintf("%s %s", price, currency.Symbol())
+}
+
+//`GetLabel returns the data printed on the label of this product with the given layout.
+//		The price is computed with the given pricelist, or is the sale price of the product
+//		if the pricelist is empty.`,
+func product_product_GetLabel(rs m.ProductProductSet, layout m.ProductLabelLayoutSet, pricelist m.ProductPricelistSet) productlabels.Label {
+	rs.EnsureOne()
+	label := productlabels.Label{
+		Name:    rs.Name(),
+		Barcode: rs.Barcode(),
+	}
+	if layout.ShowReference() {
+		label.Reference = rs.DefaultCode()
+	}
+	if layout.ShowAttributes() {
+		label.Attributes = productVariantName(rs)
+	}
+	if layout.ShowPrice() {
+		if pricelist.IsEmpty() {
+			label.Price = formatLabelPrice(rs.LstPrice(), rs.Currency())
+		} else {
+			price := pricelist.GetProductPrice(rs, 1, h.Partner().NewSet(rs.Env()), dates.Today(), rs.Uom())
+			label.Price = formatLabelPrice(price, pricelist.Currency())
+		}
+	}
+	return label
+}
+
+//`PrintLabels returns the labels of the products of this set rendered with the given layout,
+//		with the given number of copies of each label. Prices are computed with the given pricelist,
+//		or are the sale prices of the products if the pricelist is empty.`,
+func product_product_PrintLabels(rs m.ProductProductSet, layout m.ProductLabelLayoutSet, pricelist m.ProductPricelistSet, copies int) []byte {
+	layout.EnsureOne()
+	if copies < 1 {
+		copies = 1
+	}
+	var labels []productlabels.Label
+	for _, product := range rs.Records() {
+		label := product.GetLabel(layout, pricelist)
+		for i := 0; i < copies; i++ {
+			labels = append(labels, label)
+		}
+	}
+	return layout.Render(labels)
+}
+
+//`PrintLabels returns the labels of the active variants of the templates of this set rendered with
+//		the given layout, with the given number of copies of each label. Prices are computed with the
+//		given pricelist, or are the sale prices of the products if the pricelist is empty.`,
+func product_template_PrintLabels(rs m.ProductTemplateSet, layout m.ProductLabelLayoutSet, pricelist m.ProductPricelistSet, copies int) []byte {
+	products := h.ProductProduct().NewSet(rs.Env())
+	for _, tmpl := range rs.Records() {
+		products = products.Union(tmpl.ProductVariants())
+	}
+	return products.PrintLabels(layout, pricelist, copies)
+}
+
+func init() {
+	models.NewModel("ProductLabelLayout")
+	h.ProductLabelLayout().AddFields(fields_ProductLabelLayout)
+	h.ProductLabelLayout().NewMethod("GetLayout", product_label_layout_GetLayout)
+	h.ProductLabelLayout().NewMethod("CheckLayout", product_label_layout_CheckLayout)
+	h.ProductLabelLayout().NewMethod("Render", product_label_layout_Render)
+
+	h.ProductProduct().NewMethod("GetLabel", product_product_GetLabel)
+	h.ProductProduct().NewMethod("PrintLabels", product_product_PrintLabels)
+	h.ProductTemplate().NewMethod("PrintLabels", product_template_PrintLabels)
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLabels(t *testing.T) {
+	Convey("Testing product labels", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			sheet := h.ProductLabelLayout().NewSet(env).GetRecord("product_label_layout_a4_3x8")
+			thermal := h.ProductLabelLayout().NewSet(env).GetRecord("product_label_layout_zpl_2x1")
+			pricelist := h.ProductPricelist().NewSet(env).GetRecord("product_list0")
+			ptd.product71.SetDefaultCode("SOFA-1")
+			ptd.product71.SetBarcode("4006381333931")
+			ptd.template7.SetListPrice(100)
+			Convey("Label data", func() {
+				label := ptd.product71.GetLabel(sheet, pricelist)
+				So(label.Name, ShouldEqual, "Sofa")
+				So(label.Reference, ShouldEqual, "SOFA-1")
+				So(label.Barcode, ShouldEqual, "4006381333931")
+				So(label.Price, ShouldContainSubstring, "100.00")
+				So(label.Price, ShouldContainSubstring, pricelist.Currency().Symbol())
+				sheet.SetShowPrice(false)
+				sheet.SetShowReference(false)
+				label = ptd.product71.GetLabel(sheet, pricelist)
+				So(label.Price, ShouldBeEmpty)
+				So(label.Reference, ShouldBeEmpty)
+				So(label.Barcode, ShouldEqual, "4006381333931")
+			})
+			Convey("PDF label sheets", func() {
+				pdf := ptd.template7.PrintLabels(sheet, pricelist, 2)
+				So(bytes.HasPrefix(pdf, []byte("%PDF-")), ShouldBeTrue)
+				So(string(pdf), ShouldContainSubstring, "([SOFA-1]")
+			})
+			Convey("ZPL labels", func() {
+				zpl := ptd.product71.PrintLabels(thermal, pricelist, 3)
+				So(bytes.Count(zpl, []byte("^XA")), ShouldEqual, 3)
+				So(string(zpl), ShouldContainSubstring, "^BEN,")
+			})
+			Convey("Invalid layouts are refused", func() {
+				So(func() { sheet.SetColumns(4) }, ShouldPanic)
+				So(func() { thermal.SetLabelWidth(60) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
@@ -0,0 +1,253 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"log"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/hexya/src/models/types"
+	"github.com/gleke/hexya/src/models/types/dates"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+)
+
+// lifecycleStates are the lifecycle states of products
+var lifecycleStates = types.Selection{
+	"draft":       "Draft",
+	"development": "In Development",
+	"active":      "Active",
+	"end_of_life": "End of Life",
+	"obsolete":    "Obsolete",
+}
+
+// lifecycleFlags are the values of SaleOk, PurchaseOk and Active of a product in a lifecycle state
+type lifecycleFlags struct {
+	saleOk     bool
+	purchaseOk bool
+	active     bool
+}
+
+// lifecycleStateFlags maps each lifecycle state to the flags of the products in this state
+var lifecycleStateFlags = map[string]lifecycleFlags{
+	"draft":       {saleOk: false, purchaseOk: false, active: true},
+	"development": {saleOk: false, purchaseOk: true, active: true},
+	"active":      {saleOk: true, purchaseOk: true, active: true},
+	"end_of_life": {saleOk: true, purchaseOk: false, active: true},
+	"obsolete":    {saleOk: false, purchaseOk: false, active: false},
+}
+
+var fields_ProductLifecycleTransition = map[string]models.FieldDefinition{
+	"FromState": fields.Selection{String: "From", Selection: lifecycleStates, Required: true,
+		Constraint: h.ProductLifecycleTransition().Methods().CheckTransition()},
+	"ToState": fields.Selection{String: "To", Selection: lifecycleStates, Required: true,
+		Constraint: h.ProductLifecycleTransition().Methods().CheckTransition()},
+}
+
+var fields_ProductLifecycleLog = map[string]models.FieldDefinition{
+	"ProductTmpl": fields.Many2One{String: "Product", RelationModel: h.ProductTemplate(),
+		OnDelete: models.Cascade, Required: true, Index: true},
+	"FromState": fields.Selection{String: "From", Selection: lifecycleStates},
+	"ToState":   fields.Selection{String: "To", Selection: lifecycleStates, Required: true},
+	"EffectiveDate": fields.Date{String: "Effective Date", Required: true,
+		Default: func(env models.Environment) interface{} {
+			return dates.Today()
+		}},
+	"User": fields.Many2One{RelationModel: h.User(), Default: func(env models.Environment) interface{} {
+		return h.User().NewSet(env).CurrentUser()
+	}},
+	"Datetime": fields.DateTime{String: "Logged On", Default: func(env models.Environment) interface{} {
+		return dates.Now()
+	}},
+	"Applied": fields.Boolean{Help: "Unset for changes scheduled at a later effective date that are not applied yet."},
+}
+
+var fields_ProductTemplateLifecycle = map[string]models.FieldDefinition{
+	"LifecycleState": fields.Selection{String: "Lifecycle State", Selection: lifecycleStates,
+		Required: true, Default: models.DefaultValue("active"),
+		Help: `Draft: the product can be neither sold nor purchased.
+In Development: the product can be purchased but not sold.
+Active: the product can be sold and purchased.
+End of Life: the product can be sold but not purchased anymore.
+Obsolete: the product is archived.`},
+	"LifecycleDate": fields.Date{String: "State Effective Date", NoCopy: true,
+		Help: "Date from which the product is in its current lifecycle state"},
+	"LifecycleLogs": fields.One2Many{String: "Lifecycle History", RelationModel: h.ProductLifecycleLog(),
+		ReverseFK: "ProductTmpl", JSON: "lifecycle_log_ids", NoCopy: true},
+}
+
+//`CheckTransition checks that the transitions of this set change the state and are defined only once.`,
+func product_lifecycle_transition_CheckTransition(rs m.ProductLifecycleTransitionSet) {
+	for _, transition := range rs.Records() {
+		if transition.FromState() == transition.ToState() {
+			log.Panic(rs.T("Error: A lifecycle transition must change the state."))
+		}
+		if h.ProductLifecycleTransition().Search(rs.Env(),
+			q.ProductLifecycleTransition().FromState().Equals(transition.FromState()).
+				And().ToState().Equals(transition.ToState())).SearchCount() > 1 {
+			log.Panic(rs.T("Error: The lifecycle transition from %s to %s is already defined.",
+				lifecycleStates[transition.FromState()], lifecycleStates[transition.ToState()]))
+		}
+	}
+}
+
+//`IsAllowed returns true if a transition from the given state to the other given state is defined.`,
+func product_lifecycle_transition_IsAllowed(rs m.ProductLifecycleTransitionSet, fromState, toState string) bool {
+	return h.ProductLifecycleTransition().Search(rs.Env(),
+		q.ProductLifecycleTransition().FromState().Equals(fromState).
+			And().ToState().Equals(toState)).SearchCount() > 0
+}
+
+//`ApplyDueChanges applies the scheduled lifecycle changes whose effective date is reached, in
+//		the order of their effective dates. Changes that are not allowed from the current state of
+//		their product anymore are left pending. It returns the number of applied changes.`,
+func product_lifecycle_log_ApplyDueChanges(rs m.ProductLifecycleLogSet) int {
+	var count int
+	transitions := h.ProductLifecycleTransition().NewSet(rs.Env())
+	for _, change := range h.ProductLifecycleLog().Search(rs.Env(),
+		q.ProductLifecycleLog().Applied().Equals(false).
+			And().EffectiveDate().LowerOrEqual(dates.Today())).
+		OrderBy("EffectiveDate", "ID").Records() {
+
+		tmpl := change.ProductTmpl()
+		if tmpl.LifecycleState() != change.ToState() &&
+			!transitions.IsAllowed(tmpl.LifecycleState(), change.ToState()) {
+			continue
+		}
+		tmpl.WithContext("lifecycle_log_id", change.ID()).Write(h.ProductTemplate().NewData().
+			SetLifecycleState(change.ToState()).
+			SetLifecycleDate(change.EffectiveDate()))
+		count++
+	}
+	return count
+}
+
+//`ApplyLifecycleChanges applies the scheduled lifecycle changes of all products whose effective
+//		date is reached. It is meant to be called periodically by a scheduled action and returns
+//		the number of applied changes.`,
+func product_template_ApplyLifecycleChanges(rs m.ProductTemplateSet) int {
+	return h.ProductLifecycleLog().NewSet(rs.Env()).ApplyDueChanges()
+}
+
+//`ChangeLifecycleState moves the templates of this set to the given lifecycle state from the given
+//		date. The change is applied immediately if the date is the zero value or not in the future,
+//		and is scheduled otherwise (see ProductLifecycleLog's ApplyDueChanges). It panics if the
+//		transition from the current state of a template is not allowed.`,
+func product_template_ChangeLifecycleState(rs m.ProductTemplateSet, state string, date dates.Date) {
+	if date.IsZero() || !date.Greater(dates.Today()) {
+		data := h.ProductTemplate().NewData().SetLifecycleState(state)
+		if !date.IsZero() {
+			data.SetLifecycleDate(date)
+		}
+		rs.Write(data)
+		return
+	}
+	transitions := h.ProductLifecycleTransition().NewSet(rs.Env())
+	for _, tmpl := range rs.Records() {
+		if !transitions.IsAllowed(tmpl.LifecycleState(), state) {
+			log.Panic(rs.T("Error: The product %s cannot go from the state %s to the state %s.",
+				tmpl.Name(), lifecycleStates[tmpl.LifecycleState()], lifecycleStates[state]))
+		}
+		h.ProductLifecycleLog().Create(rs.Env(), h.ProductLifecycleLog().NewData().
+			SetProductTmpl(tmpl).
+			SetFromState(tmpl.LifecycleState()).
+			SetToState(state).
+			SetEffectiveDate(date))
+	}
+}
+
+// setLifecycleFlags sets in data the SaleOk, PurchaseOk and Active values matching its lifecycle state
+func setLifecycleFlags(data m.ProductTemplateData) {
+	flags := lifecycleStateFlags[data.LifecycleState()]
+	data.SetSaleOk(flags.saleOk).
+		SetPurchaseOk(flags.purchaseOk).
+		SetActive(flags.active)
+}
+
+func product_template_lifecycle_Create(rs m.ProductTemplateSet, data m.ProductTemplateData) m.ProductTemplateSet {
+	if !data.HasLifecycleState() {
+		return rs.Super().Create(data)
+	}
+	setLifecycleFlags(data)
+	if !data.HasLifecycleDate() {
+		data.SetLifecycleDate(dates.Today())
+	}
+	template := rs.Super().Create(data)
+	h.ProductLifecycleLog().Create(rs.Env(), h.ProductLifecycleLog().NewData().
+		SetProductTmpl(template).
+		SetToState(data.LifecycleState()).
+		SetEffectiveDate(data.LifecycleDate()).
+		SetApplied(true))
+	return template
+}
+
+func product_template_lifecycle_Write(rs m.ProductTemplateSet, vals m.ProductTemplateData) bool {
+	if !vals.HasLifecycleState() {
+		return rs.Super().Write(vals)
+	}
+	state := vals.LifecycleState()
+	transitions := h.ProductLifecycleTransition().NewSet(rs.Env())
+	fromStates := make(map[int64]string)
+	for _, tmpl := range rs.Records() {
+		if tmpl.LifecycleState() == state {
+			continue
+		}
+		if !transitions.IsAllowed(tmpl.LifecycleState(), state) {
+			log.Panic(rs.T("Error: The product %s cannot go from the state %s to the state %s.",
+				tmpl.Name(), lifecycleStates[tmpl.LifecycleState()], lifecycleStates[state]))
+		}
+		fromStates[tmpl.ID()] = tmpl.LifecycleState()
+	}
+	if len(fromStates) > 0 {
+		setLifecycleFlags(vals)
+		if !vals.HasLifecycleDate() {
+			vals.SetLifecycleDate(dates.Today())
+		}
+	}
+	res := rs.Super().Write(vals)
+	// 'lifecycle_log_id' is set when applying a scheduled change, which is logged already
+	if rs.Env().Context().HasKey("lifecycle_log_id") {
+		h.ProductLifecycleLog().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("lifecycle_log_id")}).
+			SetApplied(true)
+		return res
+	}
+	if len(fromStates) == 0 {
+		// The state is unchanged, so that flags given with it are kept
+		return res
+	}
+	for _, tmpl := range rs.Records() {
+		fromState, ok := fromStates[tmpl.ID()]
+		if !ok {
+			continue
+		}
+		h.ProductLifecycleLog().Create(rs.Env(), h.ProductLifecycleLog().NewData().
+			SetProductTmpl(tmpl).
+			SetFromState(fromState).
+			SetToState(state).
+			SetEffectiveDate(vals.LifecycleDate()).
+			SetApplied(true))
+	}
+	return res
+}
+
+func init() {
+	models.NewModel("ProductLifecycleTransition")
+	h.ProductLifecycleTransition().SetDefaultOrder("FromState", "ToState")
+	h.ProductLifecycleTransition().AddFields(fields_ProductLifecycleTransition)
+	h.ProductLifecycleTransition().NewMethod("CheckTransition", product_lifecycle_transition_CheckTransition)
+	h.ProductLifecycleTransition().NewMethod("IsAllowed", product_lifecycle_transition_IsAllowed)
+
+	models.NewModel("ProductLifecycleLog")
+	h.ProductLifecycleLog().SetDefaultOrder("EffectiveDate DESC", "ID DESC")
+	h.ProductLifecycleLog().AddFields(fields_ProductLifecycleLog)
+	h.ProductLifecycleLog().NewMethod("ApplyDueChanges", product_lifecycle_log_ApplyDueChanges)
+
+	h.ProductTemplate().AddFields(fields_ProductTemplateLifecycle)
+	h.ProductTemplate().NewMethod("ApplyLifecycleChanges", product_template_ApplyLifecycleChanges)
+	h.ProductTemplate().NewMethod("ChangeLifecycleState", product_template_ChangeLifecycleState)
+	h.ProductTemplate().Methods().Create().Extend(product_template_lifecycle_Create)
+	h.ProductTemplate().Methods().Write().Extend(product_template_lifecycle_Write)
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/hexya/src/models/types/dates"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProductLifecycle(t *testing.T) {
+	Convey("Testing product lifecycle states", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Lamp").
+				SetLifecycleState("draft").
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit))
+			So(template.SaleOk(), ShouldBeFalse)
+			So(template.PurchaseOk(), ShouldBeFalse)
+			So(template.LifecycleLogs().Len(), ShouldEqual, 1)
+			Convey("States set the sale, purchase and active flags and are logged", func() {
+				template.ChangeLifecycleState("development", dates.Date{})
+				So(template.SaleOk(), ShouldBeFalse)
+				So(template.PurchaseOk(), ShouldBeTrue)
+				So(template.LifecycleLogs().Len(), ShouldEqual, 2)
+				lastLog := template.LifecycleLogs().Records()[0]
+				So(lastLog.FromState(), ShouldEqual, "draft")
+				So(lastLog.ToState(), ShouldEqual, "development")
+				So(lastLog.User().Equals(h.User().NewSet(env).CurrentUser()), ShouldBeTrue)
+				So(lastLog.Applied(), ShouldBeTrue)
+				template.ChangeLifecycleState("active", dates.Date{})
+				template.ChangeLifecycleState("end_of_life", dates.Date{})
+				So(template.SaleOk(), ShouldBeTrue)
+				So(template.PurchaseOk(), ShouldBeFalse)
+				template.ChangeLifecycleState("obsolete", dates.Date{})
+				So(template.Active(), ShouldBeFalse)
+				So(template.WithContext("active_test", false).ProductVariants().Active(), ShouldBeFalse)
+			})
+			Convey("Only configured transitions are allowed", func() {
+				So(func() { template.ChangeLifecycleState("obsolete", dates.Date{}) }, ShouldPanic)
+				h.ProductLifecycleTransition().Create(env, h.ProductLifecycleTransition().NewData().
+					SetFromState("draft").
+					SetToState("obsolete"))
+				template.ChangeLifecycleState("obsolete", dates.Date{})
+				So(template.LifecycleState(), ShouldEqual, "obsolete")
+			})
+			Convey("Changes can be scheduled at a later date", func() {
+				template.ChangeLifecycleState("active", dates.ParseDate("2100-01-01"))
+				So(template.LifecycleState(), ShouldEqual, "draft")
+				pending := template.LifecycleLogs().Filtered(func(r m.ProductLifecycleLogSet) bool {
+					return !r.Applied()
+				})
+				So(pending.Len(), ShouldEqual, 1)
+				logs := h.ProductLifecycleLog().NewSet(env)
+				So(logs.ApplyDueChanges(), ShouldEqual, 0)
+				pending.SetEffectiveDate(dates.Today())
+				So(template.ApplyLifecycleChanges(), ShouldEqual, 1)
+				So(template.LifecycleState(), ShouldEqual, "active")
+				So(template.SaleOk(), ShouldBeTrue)
+				So(pending.Applied(), ShouldBeTrue)
+				So(template.LifecycleLogs().Len(), ShouldEqual, 2)
+			})
+			Convey("Setting the flags directly does not change the state", func() {
+				template.SetPurchaseOk(true)
+				So(template.LifecycleState(), ShouldEqual, "draft")
+				template.SetActive(false)
+				So(template.LifecycleState(), ShouldEqual, "draft")
+				So(template.LifecycleLogs().Len(), ShouldEqual, 1)
+				So(func() { template.ChangeLifecycleState("obsolete", dates.Date{}) }, ShouldPanic)
+			})
+			Convey("Flags written with an unchanged state are kept", func() {
+				template.Write(h.ProductTemplate().NewData().
+					SetLifecycleState("draft").
+					SetSaleOk(true).
+					SetPurchaseOk(true))
+				So(template.SaleOk(), ShouldBeTrue)
+				So(template.LifecycleState(), ShouldEqual, "draft")
+			})
+			Convey("Templates created with flags keep the default state", func() {
+				stool := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Stool").
+					SetSaleOk(false).
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit))
+				So(stool.LifecycleState(), ShouldEqual, "active")
+				So(stool.SaleOk(), ShouldBeFalse)
+			})
+		}), ShouldBeNil)
+	})
+}
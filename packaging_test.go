@@ -0,0 +1,109 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPackagings(t *testing.T) {
+	Convey("Testing packagings", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			uomUnit := h.ProductUom().NewSet(env).GetRecord("product_product_uom_unit")
+			uomDozen := h.ProductUom().NewSet(env).GetRecord("product_product_uom_dozen")
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Bottle").
+				SetUom(uomUnit).
+				SetUomPo(uomUnit))
+			product := template.ProductVariant()
+			pallet := h.ProductPackaging().Create(env, h.ProductPackaging().NewData().
+				SetName("Pallet").
+				SetProductTmpl(template).
+				SetQty(480))
+			caseP := h.ProductPackaging().Create(env, h.ProductPackaging().NewData().
+				SetName("Case").
+				SetProductTmpl(template).
+				SetParent(pallet).
+				SetQty(2).
+				SetUom(uomDozen))
+			inner := h.ProductPackaging().Create(env, h.ProductPackaging().NewData().
+				SetName("Inner").
+				SetProductTmpl(template).
+				SetParent(caseP).
+				SetQty(6))
+			Convey("Packaging quantities are converted to the product UoM", func() {
+				So(caseP.ProductQty(), ShouldAlmostEqual, 24, 0.001)
+				So(pallet.Children().Equals(caseP), ShouldBeTrue)
+			})
+			Convey("A packaging cannot be packed in a smaller one", func() {
+				So(func() { pallet.SetParent(inner) }, ShouldPanic)
+				So(func() { inner.SetQty(500) }, ShouldPanic)
+				So(func() { pallet.SetQty(12) }, ShouldPanic)
+			})
+			Convey("Suggesting packagings for a quantity", func() {
+				splits := product.SuggestPackagings(1000, h.ProductUom().NewSet(env))
+				So(splits, ShouldHaveLength, 4)
+				So(splits[0].PackagingID, ShouldEqual, pallet.ID())
+				So(splits[0].Count, ShouldEqual, 2)
+				So(splits[1].PackagingID, ShouldEqual, caseP.ID())
+				So(splits[1].Count, ShouldEqual, 1)
+				So(splits[2].PackagingID, ShouldEqual, inner.ID())
+				So(splits[2].Count, ShouldEqual, 2)
+				So(splits[3].PackagingID, ShouldEqual, 0)
+				So(splits[3].Count, ShouldEqual, 0)
+				So(splits[3].Quantity, ShouldEqual, 4)
+			})
+			Convey("Suggesting packagings for a quantity in another UoM", func() {
+				splits := product.SuggestPackagings(4, uomDozen)
+				So(splits, ShouldHaveLength, 1)
+				So(splits[0].PackagingID, ShouldEqual, caseP.ID())
+				So(splits[0].Count, ShouldEqual, 2)
+			})
+			Convey("Variant specific packagings", func() {
+				volume := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().SetName("Volume"))
+				twoLitres := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+					SetName("2 L").
+					SetAttribute(volume))
+				fiveLitres := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+					SetName("5 L").
+					SetAttribute(volume))
+				canTemplate := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Paint").
+					SetUom(uomUnit).
+					SetUomPo(uomUnit).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(volume).
+						SetValues(twoLitres.Union(fiveLitres))))
+				So(canTemplate.ProductVariants().Len(), ShouldEqual, 2)
+				var can2L, can5L = canTemplate.ProductVariants().Records()[0], canTemplate.ProductVariants().Records()[1]
+				if can2L.AttributeValues().Equals(fiveLitres) {
+					can2L, can5L = can5L, can2L
+				}
+				tmplBox := h.ProductPackaging().Create(env, h.ProductPackaging().NewData().
+					SetName("Box").
+					SetProductTmpl(canTemplate).
+					SetQty(6))
+				box5L := h.ProductPackaging().Create(env, h.ProductPackaging().NewData().
+					SetName("Box 5L").
+					SetProduct(can5L).
+					SetQty(4))
+				So(box5L.ProductTmpl().Equals(canTemplate), ShouldBeTrue)
+				So(can2L.GetPackagings().Equals(tmplBox), ShouldBeTrue)
+				So(can5L.GetPackagings().Equals(box5L), ShouldBeTrue)
+				splits := can5L.SuggestPackagings(8, h.ProductUom().NewSet(env))
+				So(splits, ShouldHaveLength, 1)
+				So(splits[0].PackagingID, ShouldEqual, box5L.ID())
+				So(splits[0].Count, ShouldEqual, 2)
+				So(func() {
+					box5L.SetProductTmpl(template)
+				}, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"github.com/gleke/hexya/src/models/fields"
 	"log"
+	"math"
 	"regexp"
 	"strings"
 
@@ -19,9 +20,11 @@ import (
 	"github.com/gleke/hexya/src/models/types"
 	"github.com/gleke/hexya/src/models/types/dates"
 	"github.com/gleke/hexya/src/tools/b64image"
+	"github.com/gleke/hexya/src/tools/nbutils"
 	"github.com/gleke/pool/h"
 	"github.com/gleke/pool/m"
 	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
 )
 
 var fields_ProductCategory = map[string]models.FieldDefinition{
@@ -110,26 +113,34 @@ var fields_ProductProduct = map[string]models.FieldDefinition{
 		Inverse: h.ProductProduct().Methods().InverseProductPrice()},
 	"PriceExtra": fields.Float{String: "Variant Price Extra",
 		Compute: h.ProductProduct().Methods().ComputeProductPriceExtra(),
-		Depends: []string{"AttributeValues", "AttributeValues.Prices", "AttributeValues.Prices.PriceExtra", "AttributeValues.Prices.ProductTmpl"},
-		Digits:  decimalPrecision.GetPrecision("Product Price"),
-		Help:    "This is the sum of the extra price of all attributes"},
+		Depends: []string{"AttributeValues", "AttributeValues.Prices", "AttributeValues.Prices.PriceExtra",
+			"AttributeValues.Prices.PriceType", "AttributeValues.Prices.ProductTmpl", "ListPrice"},
+		Digits: decimalPrecision.GetPrecision("Product Price"),
+		Help:   "This is the sum of the extra price of all attributes"},
 	"LstPrice": fields.Float{String: "Sale Price",
 		Compute: h.ProductProduct().Methods().ComputeProductLstPrice(),
-		Depends: []string{"ListPrice", "PriceExtra"},
+		Depends: []string{"ListPrice", "PriceExtra", "UseFixedSalePrice", "FixedSalePrice"},
 		Digits:  decimalPrecision.GetPrecision("Product Price"),
 		Inverse: h.ProductProduct().Methods().InverseProductLstPrice(),
-		Help:    "The sale price is managed from the product template. Click on the 'Variant Prices' button to set the extra attribute prices."},
-	"DefaultCode": fields.Char{String: "Internal Reference", Index: true},
+		Help: `The sale price is managed from the product template. Click on the 'Variant Prices' button to set the extra attribute prices.
+Setting the sale price of a variant of a product with several variants sets a fixed sale price on this variant only.`},
+	"UseFixedSalePrice": fields.Boolean{String: "Fixed Sale Price",
+		Help: "If set, the sale price of this variant is its fixed sale price instead of the sale price of the template plus the price extras"},
+	"FixedSalePrice": fields.Float{String: "Variant Sale Price", Digits: decimalPrecision.GetPrecision("Product Price"),
+		Help: "Sale price of this variant, used instead of the sale price of the template plus the price extras"},
+	"DefaultCode": fields.Char{String: "Internal Reference", Index: true, NoCopy: true,
+		Constraint: h.ProductProduct().Methods().CheckDefaultCode()},
 	"Code": fields.Char{String: "Internal Reference",
 		Compute: h.ProductProduct().Methods().ComputeProductCode(), Depends: []string{""}},
 	"PartnerRef": fields.Char{String: "Customer Ref",
 		Compute: h.ProductProduct().Methods().ComputePartnerRef(), Depends: []string{""}},
 	"Active": fields.Boolean{String: "Active",
 		Default: models.DefaultValue(true), Required: true,
-		Help: "If unchecked, it will allow you to hide the product without removing it."},
+		Constraint: h.ProductProduct().Methods().CheckBarcode(),
+		Help:       "If unchecked, it will allow you to hide the product without removing it."},
 	"ProductTmpl": fields.Many2One{String: "Product Template", RelationModel: h.ProductTemplate(),
 		Index: true, OnDelete: models.Cascade, Required: true, Embed: true},
-	"Barcode": fields.Char{String: "Barcode", NoCopy: true, /*Unique: true,*/
+	"Barcode": fields.Char{String: "Barcode", NoCopy: true, Constraint: h.ProductProduct().Methods().CheckBarcode(),
 		Help: "International Article Number used for product identification."},
 	"AttributeValues": fields.Many2Many{String: "Attributes", RelationModel: h.ProductAttributeValue(),
 		JSON:       "attribute_value_ids", /*, OnDelete: models.Restrict*/
@@ -162,6 +173,19 @@ base price on purchase orders. Expressed in the default unit of measure of the p
 	"Volume": fields.Float{Help: "The volume in m3."},
 	"Weight": fields.Float{Digits: decimalPrecision.GetPrecision("Stock Weight"),
 		Help: "The weight of the contents in Kg, not including any packaging, etc."},
+	"Length": fields.Float{OnChange: h.ProductProduct().Methods().OnchangeDimensions(),
+		Help: "The length of the product, expressed in the dimensional unit of measure."},
+	"Width": fields.Float{OnChange: h.ProductProduct().Methods().OnchangeDimensions(),
+		Help: "The width of the product, expressed in the dimensional unit of measure."},
+	"Height": fields.Float{OnChange: h.ProductProduct().Methods().OnchangeDimensions(),
+		Help: "The height of the product, expressed in the dimensional unit of measure."},
+	"DimensionalUom": fields.Many2One{String: "Dimensional UoM", RelationModel: h.ProductUom(),
+		Filter: q.ProductUom().CategoryFilteredOn(
+			q.ProductUomCategory().HexyaExternalID().Equals("product_uom_categ_length")),
+		Default: func(env models.Environment) interface{} {
+			return h.ProductUom().NewSet(env).GetReferenceLengthUom()
+		}, OnChange: h.ProductProduct().Methods().OnchangeDimensions(),
+		Help: "Unit of measure of the length, width and height of the product."},
 	"PricelistItems": fields.Many2Many{RelationModel: h.ProductPricelistItem(),
 		JSON: "pricelist_item_ids", Compute: h.ProductProduct().Methods().GetPricelistItems()},
 }
@@ -195,34 +219,55 @@ func product_product_InverseProductPrice(rs m.ProductProductSet, price float64)
 	if rs.Env().Context().HasKey("uom") {
 		price = h.ProductUom().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("uom")}).ComputePrice(price, rs.Uom())
 	}
-	price -= rs.PriceExtra()
-	rs.SetListPrice(price)
+	rs.SetListPrice(listPriceWithoutExtras(rs, price))
 }
 
-//`InverseProductLstPrice updates ListPrice from the given LstPrice`,
+//`InverseProductLstPrice sets the given LstPrice as fixed sale price of the variants of this set.
+//		The ListPrice of the template is updated instead for products without variants.`,
 func product_product_InverseProductLstPrice(rs m.ProductProductSet, price float64) {
 	if rs.Env().Context().HasKey("uom") {
 		price = h.ProductUom().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("uom")}).ComputePrice(price, rs.Uom())
 	}
-	price -= rs.PriceExtra()
-	rs.SetListPrice(price)
+	for _, product := range rs.Records() {
+		if product.ProductTmpl().ProductVariantCount() > 1 {
+			product.Write(h.ProductProduct().NewData().
+				SetUseFixedSalePrice(true).
+				SetFixedSalePrice(price))
+			continue
+		}
+		product.SetListPrice(listPriceWithoutExtras(product, price))
+	}
+}
+
+// listPriceWithoutExtras returns the sale price of the template of the given product
+// for which the sale price of the product, including its price extras, is the given price.
+func listPriceWithoutExtras(product m.ProductProductSet, price float64) float64 {
+	fixed, percentage := combinationPriceExtras(product.ProductTmpl(), product.AttributeValues())
+	return (price - fixed) / (1 + percentage/100)
 }
 
 //`ComputeProductPriceExtra computes the price extra of this product by suming the extras of each attribute`,
 func product_product_ComputeProductPriceExtra(rs m.ProductProductSet) m.ProductProductData {
-	var priceExtra float64
-	for _, attributeValue := range rs.AttributeValues().Records() {
-		for _, attributePrice := range attributeValue.Prices().Records() {
-			if attributePrice.ProductTmpl().Equals(rs.ProductTmpl()) {
-				priceExtra += attributePrice.PriceExtra()
-			}
-		}
-	}
+	priceExtra := rs.ProductTmpl().GetCombinationPriceExtra(rs.AttributeValues())
 	return h.ProductProduct().NewData().SetPriceExtra(priceExtra)
 }
 
-//`ComputeProductLstPrice computes the LstPrice from the ListPrice and the extras`,
+//`ComputeProductLstPrice computes the LstPrice from the ListPrice and the extras,
+//		from the fixed sale price of this variant if it has one, or from the sale prices
+//		of the components of kits priced from their components`,
 func product_product_ComputeProductLstPrice(rs m.ProductProductSet) m.ProductProductData {
+	if rs.UseFixedSalePrice() {
+		price := rs.FixedSalePrice()
+		if rs.Env().Context().HasKey("uom") {
+			toUoM := h.ProductUom().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("uom")})
+			price = rs.Uom().ComputePrice(price, toUoM)
+		}
+		return h.ProductProduct().NewData().SetLstPrice(price)
+	}
+	if rs.IsKit() && rs.KitListPrice() {
+		return h.ProductProduct().NewData().SetLstPrice(rs.PriceCompute(q.ProductProduct().ListPrice(),
+			h.ProductUom().NewSet(rs.Env()), h.Currency().NewSet(rs.Env()), h.Company().NewSet(rs.Env())))
+	}
 	listPrice := rs.ListPrice()
 	if rs.Env().Context().HasKey("uom") {
 		toUoM := h.ProductUom().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("uom")})
@@ -331,8 +376,36 @@ func product_product_OnchangeUom(rs m.ProductProductSet) m.ProductProductData {
 	return h.ProductProduct().NewData()
 }
 
+//`OnchangeDimensions updates the volume when the dimensions of the product are changed`,
+func product_product_OnchangeDimensions(rs m.ProductProductSet) m.ProductProductData {
+	volume := rs.DimensionalUom().ComputeVolume(rs.Length(), rs.Width(), rs.Height())
+	if volume == 0 {
+		return h.ProductProduct().NewData()
+	}
+	return h.ProductProduct().NewData().SetVolume(volume)
+}
+
+//`UpdateVolumeFromDimensions sets the volume of the products of this set for which
+//		all the dimensions are given`,
+func product_product_UpdateVolumeFromDimensions(rs m.ProductProductSet) {
+	for _, product := range rs.Records() {
+		volume := product.DimensionalUom().ComputeVolume(product.Length(), product.Width(), product.Height())
+		if volume == 0 {
+			continue
+		}
+		product.SetVolume(volume)
+	}
+}
+
 func product_product_Create(rs m.ProductProductSet, data m.ProductProductData) m.ProductProductSet {
 	product := rs.WithContext("create_product_product", true).Super().Create(data)
+	if data.HasLength() || data.HasWidth() || data.HasHeight() {
+		product.UpdateVolumeFromDimensions()
+	}
+	// Variants created with their template get their reference once the template values are set
+	if !rs.Env().Context().HasKey("create_from_tmpl") {
+		product.GenerateDefaultCode()
+	}
 	// When a unique variant is created from tmpl then the standard price is set by DefineStandardPrice
 	if !rs.Env().Context().HasKey("create_from_tmpl") && product.ProductTmpl().ProductVariants().Len() == 1 {
 		product.DefineStandardPrice(data.StandardPrice())
@@ -346,6 +419,9 @@ func product_product_Write(rs m.ProductProductSet, data m.ProductProductData) bo
 	if data.HasStandardPrice() {
 		rs.DefineStandardPrice(data.StandardPrice())
 	}
+	if data.HasLength() || data.HasWidth() || data.HasHeight() || data.HasDimensionalUom() {
+		rs.UpdateVolumeFromDimensions()
+	}
 	return res
 }
 
@@ -462,18 +538,23 @@ func product_product_NameGet(rs m.ProductProductSet) string {
 	           result.append(_name_get(mydict))
 	   return result
 	*/
-	// display only the attributes with multiple possible values on the template
+	variant := productVariantName(rs)
+	if variant != "" {
+		return fmt.Sprintf("%s (%s)", rs.PartnerRef(), variant)
+	}
+	return rs.PartnerRef()
+}
+
+// productVariantName returns the comma separated list of the attribute values of the given
+// product, restricted to the attributes with multiple possible values on its template.
+func productVariantName(rs m.ProductProductSet) string {
 	variableAttributes := h.ProductAttribute().NewSet(rs.Env())
 	for _, attrLine := range rs.AttributeLines().Records() {
 		if attrLine.Values().Len() > 1 {
 			variableAttributes = variableAttributes.Union(attrLine.Attribute())
 		}
 	}
-	variant := rs.AttributeValues().VariantName(variableAttributes)
-	if variant != "" {
-		return fmt.Sprintf("%s (%s)", rs.PartnerRef(), variant)
-	}
-	return rs.PartnerRef()
+	return rs.AttributeValues().VariantName(variableAttributes)
 }
 
 func product_product_SearchByName(rs m.ProductProductSet, name string, op operator.Operator, additionalCond q.ProductProductCondition, limit int) m.ProductProductSet {
@@ -526,6 +607,14 @@ func product_product_SearchByName(rs m.ProductProductSet, name string, op operat
 				q.ProductProduct().ProductTmplFilteredOn(q.ProductTemplate().Sellers().In(suppliers)))
 		}
 	}
+	// 'follow_successors' in context: archived products are found through their successors
+	if op.IsPositive() && rs.Env().Context().GetBool("follow_successors") && (limit <= 0 || products.Len() < limit) {
+		remaining := 0
+		if limit > 0 {
+			remaining = limit - products.Len()
+		}
+		products = products.Union(archivedProductSuccessors(rs, name, op, additionalCond, products, remaining))
+	}
 	return products
 }
 
@@ -603,7 +692,12 @@ func product_product_PriceCompute(rs m.ProductProductSet, priceType models.Field
 	}
 
 	price := product.Get(priceType.String()).(float64)
-	if priceType == q.ProductProduct().ListPrice() {
+	switch {
+	case product.IsKit() && product.KitListPrice() && priceType == q.ProductProduct().ListPrice():
+		price = product.ProductTmpl().GetKitPrice(priceType)
+	case priceType == q.ProductProduct().ListPrice() && product.UseFixedSalePrice():
+		price = product.FixedSalePrice()
+	case priceType == q.ProductProduct().ListPrice():
 		price += product.PriceExtra()
 	}
 
@@ -645,6 +739,58 @@ func product_product_GetHistoryPrice(rs m.ProductProductSet, company m.CompanySe
 	return history.Cost()
 }
 
+//`GetPackagings returns the packagings that apply to this product variant, i.e. the packagings
+//		defined specifically for this variant if any, or the packagings of its template that do not
+//		target a specific variant otherwise.`,
+func product_product_GetPackagings(rs m.ProductProductSet) m.ProductPackagingSet {
+	rs.EnsureOne()
+	packagings := h.ProductPackaging().Search(rs.Env(), q.ProductPackaging().Product().Equals(rs))
+	if packagings.IsNotEmpty() {
+		return packagings
+	}
+	return h.ProductPackaging().Search(rs.Env(),
+		q.ProductPackaging().ProductTmpl().Equals(rs.ProductTmpl()).And().Product().IsNull())
+}
+
+//`SuggestPackagings returns the best split of the given quantity into the effective packaging
+//		levels of this product, from the biggest to the smallest. The quantity is expressed
+//		in the given UoM, or in the product's UoM if uom is empty.
+//
+//		Each split holds a number of whole packages. The quantity that does not fit in any
+//		packaging is returned as a last split with a zero PackagingID and a zero Count.`,
+func product_product_SuggestPackagings(rs m.ProductProductSet, quantity float64, uom m.ProductUomSet) []producttypes.PackagingSplit {
+	rs.EnsureOne()
+	if uom.IsNotEmpty() {
+		quantity = uom.ComputeQuantity(quantity, rs.Uom(), false)
+	}
+	packagings := rs.GetPackagings().Filtered(func(r m.ProductPackagingSet) bool {
+		return r.ProductQty() > 0
+	}).Sorted(func(rs1, rs2 m.ProductPackagingSet) bool {
+		return rs1.ProductQty() > rs2.ProductQty()
+	})
+	var res []producttypes.PackagingSplit
+	remaining := quantity
+	for _, pack := range packagings.Records() {
+		// Round to the product UoM before flooring to avoid floating point artifacts
+		count := math.Floor(nbutils.Round(remaining/pack.ProductQty(), rs.Uom().Rounding()))
+		if count <= 0 {
+			continue
+		}
+		res = append(res, producttypes.PackagingSplit{
+			PackagingID: pack.ID(),
+			Count:       count,
+			Quantity:    count * pack.ProductQty(),
+		})
+		remaining = nbutils.Round(remaining-count*pack.ProductQty(), rs.Uom().Rounding())
+	}
+	if remaining > 0 {
+		res = append(res, producttypes.PackagingSplit{
+			Quantity: remaining,
+		})
+	}
+	return res
+}
+
 //`NeedProcurement`,
 func product_product_NeedProcurement(rs m.ProductProductSet) bool {
 	// When sale/product is installed alone, there is no need to create procurements. Only
@@ -656,9 +802,113 @@ var fields_ProductPackaging = map[string]models.FieldDefinition{
 	"Name": fields.Char{String: "Packaging Type", Required: true},
 	"Sequence": fields.Integer{Default: models.DefaultValue(1),
 		Help: "The first in the sequence is the default one."},
-	"ProductTmpl": fields.Many2One{String: "Product", RelationModel: h.ProductTemplate()},
-	"Qty": fields.Float{String: "Quantity per Package",
-		Help: "The total number of products you can have per pallet or box."},
+	"ProductTmpl": fields.Many2One{String: "Product", RelationModel: h.ProductTemplate(),
+		Constraint: h.ProductPackaging().Methods().CheckParent()},
+	"Product": fields.Many2One{String: "Product Variant", RelationModel: h.ProductProduct(),
+		Index: true, OnDelete: models.Cascade, Constraint: h.ProductPackaging().Methods().CheckParent(),
+		OnChange: h.ProductPackaging().Methods().OnchangeProduct(),
+		Help: `When this field is filled in, the packaging only applies to this variant.
+Variants without their own packagings use the packagings of the template.`},
+	"Parent": fields.Many2One{String: "Parent Packaging", RelationModel: h.ProductPackaging(),
+		Index: true, Constraint: h.ProductPackaging().Methods().CheckParent(),
+		Help: "The bigger packaging level in which this packaging is packed, e.g. the pallet for a case."},
+	"Children": fields.One2Many{String: "Contained Packagings", RelationModel: h.ProductPackaging(),
+		ReverseFK: "Parent", JSON: "child_ids"},
+	"Barcode": fields.Char{NoCopy: true, Constraint: h.ProductPackaging().Methods().CheckBarcode(),
+		Help: "Barcode (GTIN-14) printed on this packaging level."},
+	"Qty": fields.Float{String: "Quantity per Package", Constraint: h.ProductPackaging().Methods().CheckParent(),
+		Digits: decimalPrecision.GetPrecision("Product Unit of Measure"),
+		Help:   "The total number of products you can have per pallet or box, expressed in the packaging unit of measure."},
+	"Uom": fields.Many2One{String: "Unit of Measure", RelationModel: h.ProductUom(),
+		Constraint: h.ProductPackaging().Methods().CheckUom(),
+		Help:       "Unit of measure of the quantity per package. Keep empty to use the unit of measure of the product."},
+	"ProductQty": fields.Float{String: "Quantity in Product UoM",
+		Compute: h.ProductPackaging().Methods().ComputeProductQty(), Stored: true,
+		Depends: []string{"Qty", "Uom", "ProductTmpl", "ProductTmpl.Uom"},
+		Digits:  decimalPrecision.GetPrecision("Product Unit of Measure"),
+		Help:    "The quantity of products per package, expressed in the unit of measure of the product."},
+	"Length": fields.Float{Help: "The outer length of the package, expressed in the dimensional unit of measure."},
+	"Width":  fields.Float{Help: "The outer width of the package, expressed in the dimensional unit of measure."},
+	"Height": fields.Float{Help: "The outer height of the package, expressed in the dimensional unit of measure."},
+	"DimensionalUom": fields.Many2One{String: "Dimensional UoM", RelationModel: h.ProductUom(),
+		Filter: q.ProductUom().CategoryFilteredOn(
+			q.ProductUomCategory().HexyaExternalID().Equals("product_uom_categ_length")),
+		Default: func(env models.Environment) interface{} {
+			return h.ProductUom().NewSet(env).GetReferenceLengthUom()
+		}, Help: "Unit of measure of the length, width and height of the package."},
+	"Volume": fields.Float{Compute: h.ProductPackaging().Methods().ComputeVolume(), Stored: true,
+		Depends: []string{"Length", "Width", "Height", "DimensionalUom"},
+		Help:    "The outer volume of the package in m³, computed from its dimensions."},
+	"GrossWeight": fields.Float{Digits: decimalPrecision.GetPrecision("Stock Weight"),
+		Help: "The weight in Kg of the full package, including the products and the packaging material."},
+}
+
+//`ComputeProductQty computes the quantity per package in the product's unit of measure`,
+func product_packaging_ComputeProductQty(rs m.ProductPackagingSet) m.ProductPackagingData {
+	qty := rs.Qty()
+	if rs.Uom().IsNotEmpty() && rs.ProductTmpl().Uom().IsNotEmpty() {
+		qty = rs.Uom().ComputeQuantity(qty, rs.ProductTmpl().Uom(), false)
+	}
+	return h.ProductPackaging().NewData().SetProductQty(qty)
+}
+
+//`CheckUom checks that the packaging UoM is in the same category as the product UoM`,
+func product_packaging_CheckUom(rs m.ProductPackagingSet) {
+	for _, pack := range rs.Records() {
+		if pack.Uom().IsEmpty() || pack.ProductTmpl().IsEmpty() {
+			continue
+		}
+		if !pack.Uom().Category().Equals(pack.ProductTmpl().Uom().Category()) {
+			log.Panic(rs.T("Error: The packaging Unit of Measure must be in the same category as the product Unit of Measure."))
+		}
+	}
+}
+
+//`CheckParent checks that packagings are only packed into bigger packagings of the same product,
+//		and that the packagings packed into them are still smaller.`,
+func product_packaging_CheckParent(rs m.ProductPackagingSet) {
+	if !rs.CheckRecursion() {
+		log.Panic(rs.T("Error ! You cannot create recursive packagings."))
+	}
+	for _, pack := range rs.Union(rs.Children()).Records() {
+		if pack.Product().IsNotEmpty() && !pack.Product().ProductTmpl().Equals(pack.ProductTmpl()) {
+			log.Panic(rs.T("Error: The product variant of the packaging %s does not belong to its product template.", pack.Name()))
+		}
+		if pack.Parent().IsEmpty() {
+			continue
+		}
+		if !pack.Parent().ProductTmpl().Equals(pack.ProductTmpl()) {
+			log.Panic(rs.T("Error: A packaging can only be packed into a packaging of the same product."))
+		}
+		if pack.Parent().Product().IsNotEmpty() && !pack.Parent().Product().Equals(pack.Product()) {
+			log.Panic(rs.T("Error: A packaging can only be packed into a packaging of the same product variant."))
+		}
+		if pack.Parent().ProductQty() <= pack.ProductQty() {
+			log.Panic(rs.T("Error: The parent packaging %s must contain more products than %s.", pack.Parent().Name(), pack.Name()))
+		}
+	}
+}
+
+//`OnchangeProduct sets the product template from the product variant`,
+func product_packaging_OnchangeProduct(rs m.ProductPackagingSet) m.ProductPackagingData {
+	res := h.ProductPackaging().NewData()
+	if rs.Product().IsNotEmpty() {
+		res.SetProductTmpl(rs.Product().ProductTmpl())
+	}
+	return res
+}
+
+func product_packaging_Create(rs m.ProductPackagingSet, data m.ProductPackagingData) m.ProductPackagingSet {
+	if data.Product().IsNotEmpty() && data.ProductTmpl().IsEmpty() {
+		data.SetProductTmpl(data.Product().ProductTmpl())
+	}
+	return rs.Super().Create(data)
+}
+
+//`ComputeVolume computes the volume of this packaging from its dimensions`,
+func product_packaging_ComputeVolume(rs m.ProductPackagingSet) m.ProductPackagingData {
+	return h.ProductPackaging().NewData().
+		SetVolume(rs.DimensionalUom().ComputeVolume(rs.Length(), rs.Width(), rs.Height()))
 }
 
 var fields_ProductSupplierinfo = map[string]models.FieldDefinition{
@@ -732,6 +982,8 @@ func init() {
 	h.ProductProduct().NewMethod("ComputeImages", product_product_ComputeImages)
 	h.ProductProduct().NewMethod("CheckAttributeValueIds", product_product_CheckAttributeValueIds)
 	h.ProductProduct().NewMethod("OnchangeUom", product_product_OnchangeUom)
+	h.ProductProduct().NewMethod("OnchangeDimensions", product_product_OnchangeDimensions)
+	h.ProductProduct().NewMethod("UpdateVolumeFromDimensions", product_product_UpdateVolumeFromDimensions)
 	h.ProductProduct().NewMethod("NameFormat", product_product_NameFormat)
 	h.ProductProduct().NewMethod("OpenProductTemplate", product_product_OpenProductTemplate)
 	h.ProductProduct().NewMethod("SelectSeller", product_product_SelectSeller)
@@ -739,6 +991,8 @@ func init() {
 	h.ProductProduct().NewMethod("DefineStandardPrice", product_product_DefineStandardPrice)
 	h.ProductProduct().NewMethod("GetHistoryPrice", product_product_GetHistoryPrice)
 	h.ProductProduct().NewMethod("NeedProcurement", product_product_NeedProcurement)
+	h.ProductProduct().NewMethod("GetPackagings", product_product_GetPackagings)
+	h.ProductProduct().NewMethod("SuggestPackagings", product_product_SuggestPackagings)
 
 	h.ProductProduct().Methods().Create().Extend(product_product_Create)
 	h.ProductProduct().Methods().Write().Extend(product_product_Write)
@@ -751,6 +1005,13 @@ func init() {
 	models.NewModel("ProductPackaging")
 	h.ProductPackaging().SetDefaultOrder("Sequence")
 	h.ProductPackaging().AddFields(fields_ProductPackaging)
+	h.ProductPackaging().NewMethod("ComputeProductQty", product_packaging_ComputeProductQty)
+	h.ProductPackaging().NewMethod("CheckUom", product_packaging_CheckUom)
+	h.ProductPackaging().NewMethod("CheckParent", product_packaging_CheckParent)
+	h.ProductPackaging().NewMethod("ComputeVolume", product_packaging_ComputeVolume)
+	h.ProductPackaging().NewMethod("OnchangeProduct", product_packaging_OnchangeProduct)
+
+	h.ProductPackaging().Methods().Create().Extend(product_packaging_Create)
 
 	models.NewModel("ProductSupplierinfo")
 	h.ProductSupplierinfo().SetDefaultOrder("Sequence", "MinQty DESC", "Price")
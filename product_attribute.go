@@ -12,9 +12,11 @@ import (
 	"github.com/gleke/decimalPrecision"
 	"github.com/gleke/hexya/src/models"
 	"github.com/gleke/hexya/src/models/operator"
+	"github.com/gleke/hexya/src/models/types"
 	"github.com/gleke/pool/h"
 	"github.com/gleke/pool/m"
 	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
 )
 
 var fields_ProductAttribute = map[string]models.FieldDefinition{
@@ -24,44 +26,100 @@ var fields_ProductAttribute = map[string]models.FieldDefinition{
 	"Sequence": fields.Integer{Help: "Determine the display order"},
 	"AttributeLines": fields.One2Many{String: "Lines", RelationModel: h.ProductAttributeLine(),
 		ReverseFK: "Attribute", JSON: "attribute_line_ids"},
-	"CreateVariant": fields.Boolean{Default: models.DefaultValue(true),
-		Help: "Check this if you want to create multiple variants for this attribute."},
+	"CreateVariantMode": fields.Selection{String: "Variants Creation Mode", Selection: types.Selection{
+		"always":  "Instantly",
+		"dynamic": "Dynamically",
+		"never":   "Never",
+	}, Required: true, Default: models.DefaultValue("always"),
+		Constraint: h.ProductAttribute().Methods().CheckCustomType(),
+		Help: `Instantly: all the possible variants are created when the attribute and its values are added to a product.
+Dynamically: each variant is created only when its combination of values is requested.
+Never: the attribute values are only descriptive and do not create variants.`},
+	"CreateVariant": fields.Boolean{Compute: h.ProductAttribute().Methods().ComputeCreateVariant(),
+		Depends: []string{"CreateVariantMode"}, Stored: true,
+		Inverse: h.ProductAttribute().Methods().InverseCreateVariant(),
+		Help:    "Check this if you want to create multiple variants for this attribute."},
+}
+
+//`ComputeCreateVariant returns true if this attribute creates variants, either instantly or dynamically`,
+func product_attribute_ComputeCreateVariant(rs m.ProductAttributeSet) m.ProductAttributeData {
+	return h.ProductAttribute().NewData().SetCreateVariant(rs.CreateVariantMode() != "never")
+}
+
+//`InverseCreateVariant sets the variants creation mode of this attribute from the given value`,
+func product_attribute_InverseCreateVariant(rs m.ProductAttributeSet, value bool) {
+	for _, attr := range rs.Records() {
+		switch {
+		case !value:
+			attr.SetCreateVariantMode("never")
+		case attr.CreateVariantMode() == "never":
+			attr.SetCreateVariantMode("always")
+		}
+	}
 }
 
 //`ComputePriceExtra returns the price extra for this attribute for the product
-//		template passed as 'active_id' in the context. Returns 0 if there is not 'active_id'.`,
+//		template passed as 'active_id' in the context. Returns 0 if there is not 'active_id'.
+//		Use ProductTemplate's GetValuePriceExtra outside of the template form.`,
 func product_attribute_value_ComputePriceExtra(rs m.ProductAttributeValueSet) m.ProductAttributeValueData {
 	var priceExtra float64
 	if rs.Env().Context().HasKey("active_id") {
 		productTmpl := h.ProductTemplate().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("active_id")})
-		price := rs.Prices().Search(q.ProductAttributePrice().ProductTmpl().Equals(productTmpl))
-		priceExtra = price.PriceExtra()
+		priceExtra = productTmpl.GetValuePriceExtra(rs)
 	}
 	return h.ProductAttributeValue().NewData().SetPriceExtra(priceExtra)
 }
 
 //`InversePriceExtra sets the price extra based on the product
-//		template passed as 'active_id'. Does nothing if there is not 'active_id'.`,
+//		template passed as 'active_id'. Does nothing if there is not 'active_id'.
+//		Use ProductTemplate's SetValuePriceExtra outside of the template form.`,
 func product_attribute_value_InversePriceExtra(rs m.ProductAttributeValueSet, value float64) {
 	if !rs.Env().Context().HasKey("active_id") {
 		return
 	}
 	productTmpl := h.ProductTemplate().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("active_id")})
-	prices := h.ProductAttributePrice().Search(rs.Env(),
-		q.ProductAttributePrice().Value().In(rs).And().ProductTmpl().Equals(productTmpl))
-	if !prices.IsEmpty() {
-		prices.SetPriceExtra(value)
-		return
+	productTmpl.SetValuePriceExtra(rs, value, "")
+}
+
+// attributeValueNames returns the names of the given attribute value in the default language
+// and in each of the given languages, trimmed and in lower case.
+func attributeValueNames(value m.ProductAttributeValueSet, langs []string) map[string]bool {
+	res := map[string]bool{strings.ToLower(strings.TrimSpace(value.WithContext("lang", "").Name())): true}
+	for _, lang := range langs {
+		res[strings.ToLower(strings.TrimSpace(value.WithContext("lang", lang).Name()))] = true
 	}
-	updated := h.ProductAttributeValue().NewSet(rs.Env())
-	for _, price := range prices.Records() {
-		updated = updated.Union(price.Value())
+	return res
+}
+
+// activeLangs returns the codes of the active languages
+func activeLangs(env models.Environment) []string {
+	var res []string
+	for _, lang := range h.Lang().Search(env, q.Lang().Active().Equals(true)).Records() {
+		res = append(res, lang.Code())
 	}
-	for _, val := range rs.Subtract(updated).Records() {
-		h.ProductAttributePrice().Create(rs.Env(), h.ProductAttributePrice().NewData().
-			SetProductTmpl(productTmpl).
-			SetValue(val).
-			SetPriceExtra(value))
+	return res
+}
+
+// likeEscaper escapes the wildcards of the patterns of LIKE conditions
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+//`CheckUniqueName checks that no other value of the same attribute has the same name
+//		as the values of this set, regardless of case and in any active language.`,
+func product_attribute_value_CheckUniqueName(rs m.ProductAttributeValueSet) {
+	langs := activeLangs(rs.Env())
+	for _, value := range rs.Records() {
+		for name := range attributeValueNames(value, langs) {
+			// The names of the other values are searched in the source language and in each active language
+			for _, lang := range append([]string{""}, langs...) {
+				if h.ProductAttributeValue().NewSet(rs.Env()).WithContext("lang", lang).Search(
+					q.ProductAttributeValue().Attribute().Equals(value.Attribute()).
+						And().ID().NotEquals(value.ID()).
+						And().Name().ILike(likeEscaper.Replace(name))).SearchCount() > 0 {
+					log.Panic(rs.T("Error: The value %s already exists for the attribute %s.",
+						value.Name(), value.Attribute().Name()))
+				}
+			}
+		}
 	}
 }
 
@@ -99,10 +157,13 @@ func product_attribute_value_VariantName(rs m.ProductAttributeValueSet, variable
 }
 
 var fields_ProductAttributeValue = map[string]models.FieldDefinition{
-	"Name":     fields.Char{String: "Value", Required: true, Translate: true},
+	"Name": fields.Char{String: "Value", Required: true, Translate: true,
+		Constraint: h.ProductAttributeValue().Methods().CheckUniqueName()},
+	"Code": fields.Char{Help: `Short code of this value used in the internal reference of the variants,
+e.g. BLK or 32G. If not set, the value name is used.`},
 	"Sequence": fields.Integer{Help: "Determine the display order"},
 	"Attribute": fields.Many2One{RelationModel: h.ProductAttribute(), OnDelete: models.Cascade,
-		Required: true},
+		Required: true, Constraint: h.ProductAttributeValue().Methods().CheckUniqueName()},
 	"Products": fields.Many2One{String: "Variants", RelationModel: h.ProductProduct(),
 		JSON: "product_ids"},
 	"PriceExtra": fields.Float{String: "Attribute Price Extra",
@@ -115,10 +176,17 @@ var fields_ProductAttributeValue = map[string]models.FieldDefinition{
 }
 var fields_ProductAttributePrice = map[string]models.FieldDefinition{
 	"ProductTmpl": fields.Many2One{String: "Product Template", RelationModel: h.ProductTemplate(),
-		OnDelete: models.Cascade, Required: true},
+		OnDelete: models.Cascade, Required: true, Index: true,
+		Constraint: h.ProductAttributePrice().Methods().CheckUniquePrice()},
 	"Value": fields.Many2One{String: "Product Attribute Value", RelationModel: h.ProductAttributeValue(),
-		OnDelete: models.Cascade, Required: true},
-	"PriceExtra": fields.Float{String: "Price Extra", Digits: decimalPrecision.GetPrecision("Product Price")},
+		OnDelete: models.Cascade, Required: true,
+		Constraint: h.ProductAttributePrice().Methods().CheckUniquePrice()},
+	"PriceType": fields.Selection{String: "Price Extra Type", Selection: types.Selection{
+		producttypes.PriceExtraFixed:      "Fixed Amount",
+		producttypes.PriceExtraPercentage: "Percentage of Sale Price",
+	}, Required: true, Default: models.DefaultValue(producttypes.PriceExtraFixed)},
+	"PriceExtra": fields.Float{String: "Price Extra", Digits: decimalPrecision.GetPrecision("Product Price"),
+		Help: "Amount added to the sale price, or percentage of the sale price of the template to add"},
 }
 var fields_ProductAttributeLine = map[string]models.FieldDefinition{
 	"ProductTmpl": fields.Many2One{String: "Product Template", RelationModel: h.ProductTemplate(),
@@ -132,6 +200,61 @@ var fields_ProductAttributeLine = map[string]models.FieldDefinition{
 		Depends: []string{"Attribute", "Attribute.Name", "Values", "Values.Name"}},
 }
 
+var fields_ProductAttributeExclusion = map[string]models.FieldDefinition{
+	"ProductTmpl": fields.Many2One{String: "Product Template", RelationModel: h.ProductTemplate(),
+		OnDelete: models.Cascade, Required: true, Index: true},
+	"Value": fields.Many2One{String: "Attribute Value", RelationModel: h.ProductAttributeValue(),
+		OnDelete: models.Cascade, Required: true,
+		Constraint: h.ProductAttributeExclusion().Methods().CheckExclusion()},
+	"ExcludedValues": fields.Many2Many{String: "Incompatible Values", RelationModel: h.ProductAttributeValue(),
+		JSON: "excluded_value_ids", Constraint: h.ProductAttributeExclusion().Methods().CheckExclusion(),
+		Help: "Values that cannot be combined with the attribute value in a variant of this product"},
+}
+
+//`CheckExclusion checks that the values of this exclusion belong to different attributes.`,
+func product_attribute_exclusion_CheckExclusion(rs m.ProductAttributeExclusionSet) {
+	for _, exclusion := range rs.Records() {
+		for _, value := range exclusion.ExcludedValues().Records() {
+			if value.Attribute().Equals(exclusion.Value().Attribute()) {
+				log.Panic(rs.T("Error: The value %s cannot be excluded from the value %s of the same attribute.",
+					value.Name(), exclusion.Value().Name()))
+			}
+		}
+	}
+}
+
+func product_attribute_exclusion_Create(rs m.ProductAttributeExclusionSet, data m.ProductAttributeExclusionData) m.ProductAttributeExclusionSet {
+	res := rs.Super().Create(data)
+	// Templates being created build their variants once all their lines are set
+	if res.ProductTmpl().WithContext("active_test", false).ProductVariants().IsNotEmpty() {
+		res.ProductTmpl().CreateVariants()
+	}
+	return res
+}
+
+func product_attribute_exclusion_Write(rs m.ProductAttributeExclusionSet, vals m.ProductAttributeExclusionData) bool {
+	templates := h.ProductTemplate().NewSet(rs.Env())
+	for _, exclusion := range rs.Records() {
+		templates = templates.Union(exclusion.ProductTmpl())
+	}
+	res := rs.Super().Write(vals)
+	for _, exclusion := range rs.Records() {
+		templates = templates.Union(exclusion.ProductTmpl())
+	}
+	templates.CreateVariants()
+	return res
+}
+
+func product_attribute_exclusion_Unlink(rs m.ProductAttributeExclusionSet) int64 {
+	templates := h.ProductTemplate().NewSet(rs.Env())
+	for _, exclusion := range rs.Records() {
+		templates = templates.Union(exclusion.ProductTmpl())
+	}
+	res := rs.Super().Unlink()
+	templates.CreateVariants()
+	return res
+}
+
 //`Name returns a standard name with the attribute name and the values for searching`,
 func product_attribute_line_ComputeName(rs m.ProductAttributeLineSet) m.ProductAttributeLineData {
 	var values []string
@@ -171,13 +294,14 @@ func init() {
 	h.ProductAttribute().SetDefaultOrder("Sequence", "Name")
 
 	h.ProductAttribute().AddFields(fields_ProductAttribute)
+	h.ProductAttribute().NewMethod("ComputeCreateVariant", product_attribute_ComputeCreateVariant)
+	h.ProductAttribute().NewMethod("InverseCreateVariant", product_attribute_InverseCreateVariant)
 	models.NewModel("ProductAttributeValue")
 	h.ProductAttributeValue().SetDefaultOrder("Sequence")
 
 	h.ProductAttributeValue().AddFields(fields_ProductAttributeValue)
 
-	// TODO Convert to constrains method
-	//h.ProductAttributeValue().AddSQLConstraint("ValueCompanyUniq", "unique (name,attribute_id)", "This attribute value already exists !")
+	h.ProductAttributeValue().NewMethod("CheckUniqueName", product_attribute_value_CheckUniqueName)
 	h.ProductAttributeValue().NewMethod("ComputePriceExtra", product_attribute_value_ComputePriceExtra)
 	h.ProductAttributeValue().NewMethod("InversePriceExtra", product_attribute_value_InversePriceExtra)
 	h.ProductAttributeValue().NewMethod("VariantName", product_attribute_value_VariantName)
@@ -199,4 +323,13 @@ func init() {
 	h.ProductAttributeLine().Methods().NameGet().Extend(product_attribute_line_NameGet)
 	h.ProductAttributeLine().Methods().SearchByName().Extend(product_attribute_line_SearchByName)
 
+	models.NewModel("ProductAttributeExclusion")
+	h.ProductAttributeExclusion().AddFields(fields_ProductAttributeExclusion)
+
+	h.ProductAttributeExclusion().NewMethod("CheckExclusion", product_attribute_exclusion_CheckExclusion)
+
+	h.ProductAttributeExclusion().Methods().Create().Extend(product_attribute_exclusion_Create)
+	h.ProductAttributeExclusion().Methods().Write().Extend(product_attribute_exclusion_Write)
+	h.ProductAttributeExclusion().Methods().Unlink().Extend(product_attribute_exclusion_Unlink)
+
 }
@@ -0,0 +1,178 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gleke/decimalPrecision"
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/hexya/src/models/types"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+)
+
+var fields_ProductAttributeCustom = map[string]models.FieldDefinition{
+	"CustomType": fields.Selection{String: "Custom Value", Selection: types.Selection{
+		"text":    "Free Text",
+		"integer": "Integer",
+		"float":   "Decimal Number",
+	}, Constraint: h.ProductAttribute().Methods().CheckCustomType(),
+		Help: `If set, the value of this attribute is entered by the customer instead of being chosen among
+the attribute values. Custom values never create variants and are stored with the order lines.`},
+	"CustomMin": fields.Float{String: "Minimum",
+		Constraint: h.ProductAttribute().Methods().CheckCustomType(),
+		Help:       "Minimum custom value, or minimum number of characters other than spaces for text values"},
+	"CustomMax": fields.Float{String: "Maximum",
+		Constraint: h.ProductAttribute().Methods().CheckCustomType(),
+		Help:       "Maximum custom value, or maximum number of characters other than spaces for text values. Keep 0 for no maximum."},
+}
+
+var fields_ProductAttributeLineCustom = map[string]models.FieldDefinition{
+	"CustomPriceExtra": fields.Float{String: "Price Extra per Unit",
+		Digits: decimalPrecision.GetPrecision("Product Price"),
+		Help: `Price extra of each unit of the custom value of this attribute for this product,
+i.e. per unit of numeric values or per character of text values.`},
+}
+
+var fields_ProductAttributeCustomValue = map[string]models.FieldDefinition{
+	"Attribute": fields.Many2One{RelationModel: h.ProductAttribute(), OnDelete: models.Restrict,
+		Required: true, Filter: q.ProductAttribute().CustomType().IsNotNull()},
+	"ProductTmpl": fields.Many2One{String: "Product Template", RelationModel: h.ProductTemplate(),
+		OnDelete: models.Cascade, Required: true},
+	"CustomValue": fields.Char{String: "Value", Required: true,
+		Constraint: h.ProductAttributeCustomValue().Methods().CheckCustomValue()},
+	"PriceExtra": fields.Float{String: "Price Extra",
+		Compute: h.ProductAttributeCustomValue().Methods().ComputePriceExtra(),
+		Depends: []string{"Attribute", "ProductTmpl", "CustomValue"},
+		Digits:  decimalPrecision.GetPrecision("Product Price")},
+}
+
+//`CheckCustomType checks that custom attributes do not create variants and have a valid range`,
+func product_attribute_CheckCustomType(rs m.ProductAttributeSet) {
+	for _, attr := range rs.Records() {
+		if attr.CustomType() == "" {
+			continue
+		}
+		if attr.CreateVariantMode() != "never" {
+			log.Panic(rs.T("Error: The attribute %s has custom values and cannot create variants.", attr.Name()))
+		}
+		if attr.CustomMax() != 0 && attr.CustomMax() < attr.CustomMin() {
+			log.Panic(rs.T("Error: The maximum custom value of the attribute %s is lower than its minimum.", attr.Name()))
+		}
+	}
+}
+
+// customTextLength returns the number of characters of the given custom text other than spaces,
+// which is both checked against the range of the attribute and priced.
+func customTextLength(value string) int {
+	var count int
+	for _, r := range value {
+		if !unicode.IsSpace(r) {
+			count++
+		}
+	}
+	return count
+}
+
+//`ParseCustomValue returns the given custom value of this attribute normalized, e.g.
+//		trimmed for texts or formatted for numbers. It panics if the value is not valid
+//		for the type or out of the range of this attribute.`,
+func product_attribute_ParseCustomValue(rs m.ProductAttributeSet, value string) string {
+	rs.EnsureOne()
+	value = strings.TrimSpace(value)
+	var number float64
+	switch rs.CustomType() {
+	case "text":
+		number = float64(customTextLength(value))
+	case "integer":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Panic(rs.T("Error: %s is not a valid integer for the attribute %s.", value, rs.Name()))
+		}
+		number, value = float64(n), strconv.FormatInt(n, 10)
+	case "float":
+		f, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			log.Panic(rs.T("Error: %s is not a valid number for the attribute %s.", value, rs.Name()))
+		}
+		number, value = f, strconv.FormatFloat(f, 'f', -1, 64)
+	default:
+		log.Panic(rs.T("Error: The attribute %s does not accept custom values.", rs.Name()))
+	}
+	if number < rs.CustomMin() || (rs.CustomMax() != 0 && number > rs.CustomMax()) {
+		log.Panic(rs.T("Error: The value %s of the attribute %s is out of range.", value, rs.Name()))
+	}
+	return value
+}
+
+//`CustomValueUnits returns the number of units of the given custom value of this attribute used
+//		to compute its price: the value itself for numbers and the number of characters other than
+//		spaces for texts.`,
+func product_attribute_CustomValueUnits(rs m.ProductAttributeSet, value string) float64 {
+	rs.EnsureOne()
+	value = rs.ParseCustomValue(value)
+	if rs.CustomType() == "text" {
+		return float64(customTextLength(value))
+	}
+	units, _ := strconv.ParseFloat(value, 64)
+	return units
+}
+
+//`GetCustomPriceExtra returns the price extra of the given custom value of the given
+//		attribute for this template, i.e. the value units multiplied by the price extra
+//		per unit of the attribute line.`,
+func product_template_GetCustomPriceExtra(rs m.ProductTemplateSet, attribute m.ProductAttributeSet, value string) float64 {
+	rs.EnsureOne()
+	line := h.ProductAttributeLine().Search(rs.Env(),
+		q.ProductAttributeLine().ProductTmpl().Equals(rs).And().Attribute().Equals(attribute)).Limit(1)
+	if line.IsEmpty() || line.CustomPriceExtra() == 0 {
+		return 0
+	}
+	return attribute.CustomValueUnits(value) * line.CustomPriceExtra()
+}
+
+//`CheckCustomValue checks that the custom value is valid for its attribute`,
+func product_attribute_custom_value_CheckCustomValue(rs m.ProductAttributeCustomValueSet) {
+	for _, customValue := range rs.Records() {
+		customValue.Attribute().ParseCustomValue(customValue.CustomValue())
+	}
+}
+
+//`ComputePriceExtra returns the price extra of this custom value for its template`,
+func product_attribute_custom_value_ComputePriceExtra(rs m.ProductAttributeCustomValueSet) m.ProductAttributeCustomValueData {
+	var priceExtra float64
+	if rs.Attribute().IsNotEmpty() && rs.ProductTmpl().IsNotEmpty() {
+		priceExtra = rs.ProductTmpl().GetCustomPriceExtra(rs.Attribute(), rs.CustomValue())
+	}
+	return h.ProductAttributeCustomValue().NewData().SetPriceExtra(priceExtra)
+}
+
+func product_attribute_custom_value_NameGet(rs m.ProductAttributeCustomValueSet) string {
+	return fmt.Sprintf("%s: %s", rs.Attribute().Name(), rs.CustomValue())
+}
+
+func init() {
+	h.ProductAttribute().AddFields(fields_ProductAttributeCustom)
+	h.ProductAttribute().NewMethod("CheckCustomType", product_attribute_CheckCustomType)
+	h.ProductAttribute().NewMethod("ParseCustomValue", product_attribute_ParseCustomValue)
+	h.ProductAttribute().NewMethod("CustomValueUnits", product_attribute_CustomValueUnits)
+
+	h.ProductAttributeLine().AddFields(fields_ProductAttributeLineCustom)
+
+	h.ProductTemplate().NewMethod("GetCustomPriceExtra", product_template_GetCustomPriceExtra)
+
+	models.NewModel("ProductAttributeCustomValue")
+	h.ProductAttributeCustomValue().AddFields(fields_ProductAttributeCustomValue)
+	h.ProductAttributeCustomValue().NewMethod("CheckCustomValue", product_attribute_custom_value_CheckCustomValue)
+	h.ProductAttributeCustomValue().NewMethod("ComputePriceExtra", product_attribute_custom_value_ComputePriceExtra)
+	h.ProductAttributeCustomValue().Methods().NameGet().Extend(product_attribute_custom_value_NameGet)
+}
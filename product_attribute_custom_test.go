@@ -0,0 +1,81 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCustomAttributeValues(t *testing.T) {
+	Convey("Testing custom attribute values", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			engraving := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+				SetName("Engraving").
+				SetCreateVariantMode("never").
+				SetCustomType("text").
+				SetCustomMax(20))
+			length := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+				SetName("Length (cm)").
+				SetCreateVariantMode("never").
+				SetCustomType("float").
+				SetCustomMin(10).
+				SetCustomMax(250))
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Cable").
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit).
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(engraving).
+					SetCustomPriceExtra(0.5)).
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(length).
+					SetCustomPriceExtra(0.1)).
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(ptd.prodAtt1).
+					SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))))
+			Convey("Custom attributes do not create variants", func() {
+				So(template.ProductVariants().Len(), ShouldEqual, 2)
+				So(func() { engraving.SetCreateVariantMode("always") }, ShouldPanic)
+				So(func() {
+					h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+						SetName("Width").
+						SetCustomType("integer"))
+				}, ShouldPanic)
+				So(func() { length.SetCustomMax(5) }, ShouldPanic)
+			})
+			Convey("Custom values are checked and normalized", func() {
+				So(engraving.ParseCustomValue("  Happy Birthday "), ShouldEqual, "Happy Birthday")
+				So(func() { engraving.ParseCustomValue("A message that is much too long") }, ShouldPanic)
+				So(engraving.ParseCustomValue("Happy Birthday to you"), ShouldEqual, "Happy Birthday to you")
+				So(length.ParseCustomValue("12,50"), ShouldEqual, "12.5")
+				So(func() { length.ParseCustomValue("5") }, ShouldPanic)
+				So(func() { length.ParseCustomValue("long") }, ShouldPanic)
+				So(func() { ptd.prodAtt1.ParseCustomValue("16 GB") }, ShouldPanic)
+			})
+			Convey("Custom values drive the price", func() {
+				So(engraving.CustomValueUnits("Happy Birthday"), ShouldEqual, 13)
+				So(template.GetCustomPriceExtra(engraving, "Happy Birthday"), ShouldEqual, 6.5)
+				So(template.GetCustomPriceExtra(length, "150"), ShouldAlmostEqual, 15)
+				customValue := h.ProductAttributeCustomValue().Create(env, h.ProductAttributeCustomValue().NewData().
+					SetProductTmpl(template).
+					SetAttribute(length).
+					SetCustomValue("120"))
+				So(customValue.PriceExtra(), ShouldAlmostEqual, 12)
+				So(customValue.NameGet(), ShouldEqual, "Length (cm): 120")
+				So(func() {
+					h.ProductAttributeCustomValue().Create(env, h.ProductAttributeCustomValue().NewData().
+						SetProductTmpl(template).
+						SetAttribute(length).
+						SetCustomValue("300"))
+				}, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
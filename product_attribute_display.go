@@ -0,0 +1,158 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/gleke/hexya/src/controllers"
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/hexya/src/models/types"
+	"github.com/gleke/hexya/src/server"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
+)
+
+var fields_ProductAttributeDisplay = map[string]models.FieldDefinition{
+	"DisplayType": fields.Selection{Selection: types.Selection{
+		"radio":  "Radio",
+		"select": "Select",
+		"color":  "Color",
+		"pills":  "Pills",
+	}, Required: true, Default: models.DefaultValue("radio"),
+		Help: "How the values of this attribute are presented to the customers"},
+}
+
+var fields_ProductAttributeValueDisplay = map[string]models.FieldDefinition{
+	"HtmlColor": fields.Char{String: "HTML Color Index",
+		Constraint: h.ProductAttributeValue().Methods().CheckHtmlColor(),
+		Help:       "Color of the swatch of this value for attributes displayed as colors, e.g. #FF0000"},
+	"Image": fields.Binary{Help: "Image of the swatch of this value, used instead of its color"},
+}
+
+// htmlColor matches the HTML colors in hexadecimal notation
+var htmlColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+//`CheckHtmlColor checks that the HTML color of the values of this set is in hexadecimal notation`,
+func product_attribute_value_CheckHtmlColor(rs m.ProductAttributeValueSet) {
+	for _, value := range rs.Records() {
+		if value.HtmlColor() != "" && !htmlColor.MatchString(value.HtmlColor()) {
+			log.Panic(rs.T("Error: %s is not a valid HTML color. Use the #RRGGBB notation.", value.HtmlColor()))
+		}
+	}
+}
+
+//`GetConfiguration returns the description of the configurable attributes of this template,
+//		with their values and price extras.`,
+func product_template_GetConfiguration(rs m.ProductTemplateSet) producttypes.ProductConfiguration {
+	rs.EnsureOne()
+	res := producttypes.ProductConfiguration{
+		TemplateID: rs.ID(),
+		Name:       rs.Name(),
+		ListPrice:  rs.ListPrice(),
+		Currency:   rs.Currency().Symbol(),
+		Exclusions: make(map[int64][]int64),
+	}
+	lines := rs.AttributeLines().Sorted(func(rs1, rs2 m.ProductAttributeLineSet) bool {
+		if rs1.Attribute().Sequence() != rs2.Attribute().Sequence() {
+			return rs1.Attribute().Sequence() < rs2.Attribute().Sequence()
+		}
+		return rs1.Attribute().Name() < rs2.Attribute().Name()
+	})
+	for _, line := range lines.Records() {
+		attr := line.Attribute()
+		cAttr := producttypes.ConfigurableAttribute{
+			ID:                attr.ID(),
+			Name:              attr.Name(),
+			DisplayType:       attr.DisplayType(),
+			CreateVariantMode: attr.CreateVariantMode(),
+			CustomType:        attr.CustomType(),
+			CustomMin:         attr.CustomMin(),
+			CustomMax:         attr.CustomMax(),
+			CustomPriceExtra:  line.CustomPriceExtra(),
+			Values:            []producttypes.ConfigurableValue{},
+		}
+		for _, value := range line.Values().Records() {
+			cValue := producttypes.ConfigurableValue{
+				ID:         value.ID(),
+				Name:       value.Name(),
+				HTMLColor:  value.HtmlColor(),
+				PriceExtra: rs.GetCombinationPriceExtra(value),
+			}
+			if value.Image() != "" {
+				cValue.ImageURL = fmt.Sprintf("/web/image?model=ProductAttributeValue&id=%d&field=image", value.ID())
+			}
+			cAttr.Values = append(cAttr.Values, cValue)
+		}
+		res.Attributes = append(res.Attributes, cAttr)
+	}
+	for value, excluded := range rs.VariantExclusions() {
+		for other := range excluded {
+			res.Exclusions[value] = append(res.Exclusions[value], other)
+		}
+		sort.Slice(res.Exclusions[value], func(i, j int) bool {
+			return res.Exclusions[value][i] < res.Exclusions[value][j]
+		})
+	}
+	return res
+}
+
+// ProductConfiguration serves as JSON the configurable attributes of the product
+// template whose ID is given in the route.
+func ProductConfiguration(c *server.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Error(fmt.Errorf("unable to read product template ID: %s", err))
+		return
+	}
+	uid, ok := c.Session().Get("uid").(int64)
+	if !ok {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	var (
+		res   producttypes.ProductConfiguration
+		found bool
+	)
+	err = models.ExecuteInNewEnvironment(uid, func(env models.Environment) {
+		tmpl := h.ProductTemplate().Search(env, q.ProductTemplate().ID().Equals(id))
+		if tmpl.IsEmpty() {
+			return
+		}
+		found = true
+		res = tmpl.GetConfiguration()
+	})
+	switch {
+	case err != nil:
+		c.Error(fmt.Errorf("unable to get product configuration: %s", err))
+	case !found:
+		c.AbortWithStatus(http.StatusNotFound)
+	default:
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// registerRoutes registers the controllers of the product module.
+// It must be called after the web module registered its routes.
+func registerRoutes() {
+	web := controllers.Registry.MustGetGroup("/web")
+	web.AddController(http.MethodGet, "/product/configuration/:id", ProductConfiguration)
+}
+
+func init() {
+	h.ProductAttribute().AddFields(fields_ProductAttributeDisplay)
+
+	h.ProductAttributeValue().AddFields(fields_ProductAttributeValueDisplay)
+	h.ProductAttributeValue().NewMethod("CheckHtmlColor", product_attribute_value_CheckHtmlColor)
+
+	h.ProductTemplate().NewMethod("GetConfiguration", product_template_GetConfiguration)
+}
@@ -0,0 +1,279 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAttributeDisplay(t *testing.T) {
+	Convey("Testing attribute display and product configuration", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			color := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+				SetName("Color").
+				SetSequence(1).
+				SetDisplayType("color"))
+			red := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("Red").
+				SetHtmlColor("#FF0000").
+				SetAttribute(color))
+			blue := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("Blue").
+				SetHtmlColor("#00f").
+				SetAttribute(color))
+			Convey("HTML colors must be in hexadecimal notation", func() {
+				So(func() { red.SetHtmlColor("red") }, ShouldPanic)
+				So(func() { red.SetHtmlColor("#FF00") }, ShouldPanic)
+				So(func() { red.SetHtmlColor("") }, ShouldNotPanic)
+			})
+			Convey("Attributes are displayed as radio buttons by default", func() {
+				So(ptd.prodAtt1.DisplayType(), ShouldEqual, "radio")
+			})
+			Convey("Configurations describe attributes, values and price extras", func() {
+				template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Chair").
+					SetListPrice(50).
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(ptd.prodAtt1).
+						SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(color).
+						SetValues(red.Union(blue))).
+					CreateAttributeExclusions(h.ProductAttributeExclusion().NewData().
+						SetValue(red).
+						SetExcludedValues(ptd.prodAttr1V2)))
+				h.ProductAttributePrice().Create(env, h.ProductAttributePrice().NewData().
+					SetProductTmpl(template).
+					SetValue(blue).
+					SetPriceExtra(7.5))
+				config := template.GetConfiguration()
+				So(config.TemplateID, ShouldEqual, template.ID())
+				So(config.ListPrice, ShouldEqual, 50)
+				So(config.Attributes, ShouldHaveLength, 2)
+				colorConfig := config.Attributes[0]
+				if colorConfig.ID != color.ID() {
+					colorConfig = config.Attributes[1]
+				}
+				So(colorConfig.DisplayType, ShouldEqual, "color")
+				So(colorConfig.Values, ShouldHaveLength, 2)
+				for _, value := range colorConfig.Values {
+					switch value.ID {
+					case red.ID():
+						So(value.HTMLColor, ShouldEqual, "#FF0000")
+						So(value.PriceExtra, ShouldEqual, 0)
+					case blue.ID():
+						So(value.HTMLColor, ShouldEqual, "#00f")
+						So(value.PriceExtra, ShouldEqual, 7.5)
+					}
+				}
+				So(config.Exclusions[red.ID()], ShouldResemble, []int64{ptd.prodAttr1V2.ID()})
+				So(config.Exclusions[ptd.prodAttr1V2.ID()], ShouldResemble, []int64{red.ID()})
+				data, err := json.Marshal(config)
+				So(err, ShouldBeNil)
+				So(string(data), ShouldContainSubstring, `"display_type":"color"`)
+			})
+		}), ShouldBeNil)
+	})
+}
+
+func TestAttributePrices(t *testing.T) {
+	Convey("Testing attribute value price extras", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Lamp").
+				SetListPrice(200).
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit).
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(ptd.prodAtt1).
+					SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))))
+			variant2 := template.FindVariant(ptd.prodAttr1V2)
+			Convey("Price extras are read and written without context", func() {
+				So(template.GetValuePriceExtra(ptd.prodAttr1V2), ShouldEqual, 0)
+				template.SetValuePriceExtra(ptd.prodAttr1V2, 30, "")
+				So(template.GetValuePriceExtra(ptd.prodAttr1V2), ShouldEqual, 30)
+				So(variant2.LstPrice(), ShouldEqual, 230)
+				template.SetValuePriceExtra(ptd.prodAttr1V2, 40, "")
+				So(ptd.prodAttr1V2.Prices().Len(), ShouldEqual, 1)
+				So(variant2.LstPrice(), ShouldEqual, 240)
+				template.SetValuePriceExtra(ptd.prodAttr1V2, 0, "")
+				So(ptd.prodAttr1V2.Prices().IsEmpty(), ShouldBeTrue)
+			})
+			Convey("The template form still uses active_id", func() {
+				ptd.prodAttr1V1.WithContext("active_id", template.ID()).SetPriceExtra(12)
+				So(template.GetValuePriceExtra(ptd.prodAttr1V1), ShouldEqual, 12)
+				So(ptd.prodAttr1V1.WithContext("active_id", template.ID()).PriceExtra(), ShouldEqual, 12)
+				So(ptd.prodAttr1V1.PriceExtra(), ShouldEqual, 0)
+			})
+			Convey("Price extras can be percentages of the sale price", func() {
+				template.SetValuePriceExtra(ptd.prodAttr1V2, 10, producttypes.PriceExtraPercentage)
+				So(variant2.PriceExtra(), ShouldEqual, 20)
+				So(variant2.LstPrice(), ShouldEqual, 220)
+				template.SetListPrice(300)
+				So(variant2.LstPrice(), ShouldEqual, 330)
+				variant2.SetLstPrice(440)
+				So(template.ListPrice(), ShouldEqual, 300)
+				So(variant2.LstPrice(), ShouldEqual, 440)
+				So(func() { template.SetValuePriceExtra(ptd.prodAttr1V2, 10, "discount") }, ShouldPanic)
+			})
+			Convey("The price extra matrix is edited in bulk", func() {
+				other := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Shade").
+					SetListPrice(50).
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(ptd.prodAtt1).
+						SetValues(ptd.prodAttr1V1)))
+				templates := template.Union(other)
+				So(templates.GetPriceExtraMatrix(), ShouldHaveLength, 3)
+				templates.SetPriceExtraMatrix([]producttypes.AttributePriceExtra{
+					{TemplateID: template.ID(), ValueID: ptd.prodAttr1V1.ID(), PriceExtra: 5},
+					{TemplateID: template.ID(), ValueID: ptd.prodAttr1V2.ID(), PriceExtra: 50,
+						PriceType: producttypes.PriceExtraPercentage},
+					{TemplateID: other.ID(), ValueID: ptd.prodAttr1V1.ID(), PriceExtra: 7},
+				})
+				for _, entry := range templates.GetPriceExtraMatrix() {
+					switch {
+					case entry.TemplateID == other.ID():
+						So(entry.Amount, ShouldEqual, 7)
+					case entry.ValueID == ptd.prodAttr1V2.ID():
+						So(entry.PriceType, ShouldEqual, producttypes.PriceExtraPercentage)
+						So(entry.Amount, ShouldEqual, 100)
+					default:
+						So(entry.Amount, ShouldEqual, 5)
+					}
+				}
+				So(other.ProductVariant().LstPrice(), ShouldEqual, 57)
+				So(func() {
+					other.SetPriceExtraMatrix([]producttypes.AttributePriceExtra{
+						{TemplateID: template.ID(), ValueID: ptd.prodAttr1V1.ID(), PriceExtra: 1},
+					})
+				}, ShouldPanic)
+			})
+			Convey("A value has a single price extra per template", func() {
+				template.SetValuePriceExtra(ptd.prodAttr1V1, 5, "")
+				So(func() {
+					h.ProductAttributePrice().Create(env, h.ProductAttributePrice().NewData().
+						SetProductTmpl(template).
+						SetValue(ptd.prodAttr1V1).
+						SetPriceExtra(8))
+				}, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
+
+func TestAttributeValueMerge(t *testing.T) {
+	Convey("Testing attribute value uniqueness and merge", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			color := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().SetName("Color"))
+			black := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("Black").
+				SetAttribute(color))
+			jetBlack := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("Jet Black").
+				SetAttribute(color))
+			Convey("Values are unique per attribute regardless of case", func() {
+				So(func() {
+					h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+						SetName(" black ").
+						SetAttribute(color))
+				}, ShouldPanic)
+				So(func() { jetBlack.SetName("BLACK") }, ShouldPanic)
+				So(func() {
+					h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+						SetName("Black").
+						SetAttribute(ptd.prodAtt1))
+				}, ShouldNotPanic)
+				So(color.FindDuplicateValues(), ShouldBeEmpty)
+			})
+			Convey("Merged values are replaced everywhere", func() {
+				template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Pen").
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(color).
+						SetValues(black.Union(jetBlack))).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(ptd.prodAtt1).
+						SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))).
+					CreateAttributeExclusions(h.ProductAttributeExclusion().NewData().
+						SetValue(ptd.prodAttr1V2).
+						SetExcludedValues(jetBlack)))
+				So(template.ProductVariants().Len(), ShouldEqual, 3)
+				template.SetValuePriceExtra(jetBlack, 3, "")
+				jetBlack.MergeInto(black)
+				So(h.ProductAttributeValue().Search(env,
+					q.ProductAttributeValue().ID().Equals(jetBlack.ID())).IsEmpty(), ShouldBeTrue)
+				So(template.AttributeLines().Filtered(func(r m.ProductAttributeLineSet) bool {
+					return r.Attribute().Equals(color)
+				}).Values().Equals(black), ShouldBeTrue)
+				for _, variant := range template.ProductVariants().Records() {
+					So(variant.AttributeValues().Intersect(black).IsNotEmpty(), ShouldBeTrue)
+				}
+				So(template.GetValuePriceExtra(black), ShouldEqual, 3)
+				So(template.AttributeExclusions().ExcludedValues().Equals(black), ShouldBeTrue)
+			})
+			Convey("Replacing values reports the variants that collapse", func() {
+				template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Pen").
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(color).
+						SetValues(black.Union(jetBlack))).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(ptd.prodAtt1).
+						SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))))
+				other := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Ink").
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(color).
+						SetValues(jetBlack)))
+				report := jetBlack.ReplaceWith(black)
+				So(report.ValueIDs, ShouldResemble, []int64{jetBlack.ID()})
+				So(report.TargetID, ShouldEqual, black.ID())
+				So(report.TemplateIDs, ShouldHaveLength, 2)
+				So(report.TemplateIDs, ShouldContain, template.ID())
+				So(report.TemplateIDs, ShouldContain, other.ID())
+				So(report.Duplicates, ShouldHaveLength, 2)
+				for _, duplicate := range report.Duplicates {
+					So(duplicate.TemplateID, ShouldEqual, template.ID())
+					So(duplicate.ProductIDs, ShouldHaveLength, 2)
+				}
+				So(other.ProductVariant().AttributeValues().Equals(black), ShouldBeTrue)
+			})
+			Convey("Renaming a value merges it into an existing value", func() {
+				report := jetBlack.Rename("Graphite")
+				So(jetBlack.Name(), ShouldEqual, "Graphite")
+				So(report.TargetID, ShouldEqual, jetBlack.ID())
+				So(report.Duplicates, ShouldBeEmpty)
+				report = jetBlack.Rename("BLACK")
+				So(report.TargetID, ShouldEqual, black.ID())
+				So(color.Values().Equals(black), ShouldBeTrue)
+			})
+			Convey("Values of another attribute cannot be merged", func() {
+				So(func() { ptd.prodAttr1V1.MergeInto(black) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
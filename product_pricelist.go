@@ -56,6 +56,25 @@ func product_pricelist_SearchByName(rs m.ProductPricelistSet, name string, op op
 func product_pricelist_ComputePriceRule(rs m.ProductPricelistSet, product m.ProductProductSet, quantity float64, partner m.PartnerSet,
 	date dates.Date, uom m.ProductUomSet) (float64, m.ProductPricelistItemSet) {
 
+	return computePriceRule(rs, product, quantity, partner, date, uom, nil)
+}
+
+// A combinationPrice gives the sale price of a combination of attribute values that differs
+// from the values of the priced product (see ProductTemplate's GetCombinationPricelistPrice).
+type combinationPrice struct {
+	// listPrice is the sale price of the combination in the UoM and currency of the product
+	listPrice float64
+	// proxy is true if the product only stands for a variant that does not exist yet,
+	// in which case the rules of the product itself are ignored
+	proxy bool
+}
+
+// computePriceRule computes the price of the given product according to the given pricelist as
+// ComputePriceRule does. If combination is not nil, its list price is used instead of the sale
+// price of the product.
+func computePriceRule(rs m.ProductPricelistSet, product m.ProductProductSet, quantity float64, partner m.PartnerSet,
+	date dates.Date, uom m.ProductUomSet, combination *combinationPrice) (float64, m.ProductPricelistItemSet) {
+
 	rs.EnsureOne()
 	if date.IsZero() {
 		date = dates.Today()
@@ -112,8 +131,18 @@ func product_pricelist_ComputePriceRule(rs m.ProductPricelistSet, product m.Prod
 		}
 	}
 	priceUom := qtyUom
-	price = product.PriceCompute(q.ProductProduct().ListPrice(),
-		h.ProductUom().NewSet(rs.Env()), h.Currency().NewSet(rs.Env()), h.Company().NewSet(rs.Env()))
+	// basePrice returns the price field defined by priceType in the context UoM, i.e. QtyUom
+	basePrice := func(priceType models.FieldName) float64 {
+		if combination == nil || priceType != q.ProductProduct().ListPrice() {
+			return product.PriceCompute(priceType, h.ProductUom().NewSet(rs.Env()), h.Currency().NewSet(rs.Env()),
+				h.Company().NewSet(rs.Env()))
+		}
+		if uom.IsEmpty() {
+			return combination.listPrice
+		}
+		return product.Uom().ComputePrice(combination.listPrice, uom)
+	}
+	price = basePrice(q.ProductProduct().ListPrice())
 
 	for _, rule := range items.Records() {
 		if rule.MinQuantity() != 0 && qtyInProductUom < rule.MinQuantity() {
@@ -122,7 +151,7 @@ func product_pricelist_ComputePriceRule(rs m.ProductPricelistSet, product m.Prod
 		if !rule.ProductTmpl().IsEmpty() && !product.ProductTmpl().Equals(rule.ProductTmpl()) {
 			continue
 		}
-		if !rule.Product().IsEmpty() && !product.Equals(rule.Product()) {
+		if !rule.Product().IsEmpty() && (!product.Equals(rule.Product()) || (combination != nil && combination.proxy)) {
 			continue
 		}
 		if !rule.Category().IsEmpty() {
@@ -136,15 +165,20 @@ func product_pricelist_ComputePriceRule(rs m.ProductPricelistSet, product m.Prod
 				continue
 			}
 		}
-		if rule.Base() == "pricelist" && !rule.BasePricelist().IsEmpty() {
-			priceTmp, _ := rule.BasePricelist().ComputePriceRule(product, quantity, partner, dates.Date{},
-				h.ProductUom().NewSet(rs.Env()))
+		switch {
+		case rule.Base() == "pricelist" && !rule.BasePricelist().IsEmpty():
+			priceTmp, _ := computePriceRule(rule.BasePricelist(), product, quantity, partner, dates.Date{},
+				h.ProductUom().NewSet(rs.Env()), combination)
 			price = rule.BasePricelist().Currency().Compute(priceTmp, rs.Currency(), false)
-		} else {
+		case rule.Base() == "kit" && product.IsKit():
+			// Component prices are given per unit of the kit, converted to the pricelist currency
+			price = product.Uom().ComputePrice(
+				product.ProductTmpl().GetKitPricelistPrice(rs, qtyInProductUom, partner, date), qtyUom)
+		case rule.Base() == "kit":
+			price = basePrice(q.ProductProduct().ListPrice())
+		default:
 			// if base option is public price take sale price else cost price of product
-			// price_compute returns the price in the context UoM, i.e. QtyUom
-			price = product.PriceCompute(models.FieldName(rule.Base()), h.ProductUom().NewSet(rs.Env()),
-				h.Currency().NewSet(rs.Env()), h.Company().NewSet(rs.Env()))
+			price = basePrice(models.FieldName(rule.Base()))
 		}
 		convertToPriceUom := func(p float64) float64 {
 			return product.Uom().ComputePrice(p, priceUom)
@@ -181,7 +215,8 @@ func product_pricelist_ComputePriceRule(rs m.ProductPricelistSet, product m.Prod
 		break
 	}
 	// Final price conversion into pricelist currency
-	if !suitableRule.IsEmpty() && suitableRule.ComputePrice() != "fixed" && suitableRule.Base() != "pricelist" {
+	if !suitableRule.IsEmpty() && suitableRule.ComputePrice() != "fixed" && suitableRule.Base() != "pricelist" &&
+		!(suitableRule.Base() == "kit" && product.IsKit()) {
 		price = product.Currency().Compute(price, rs.Currency(), false)
 	}
 	return price, suitableRule
@@ -267,11 +302,14 @@ to lowest sequence and stops as soon as a matching item is found.`},
 		"ListPrice":     "Public Price",
 		"StandardPrice": "Cost",
 		"pricelist":     "Other Pricelist",
+		"kit":           "Kit Components",
 	}, Default: models.DefaultValue("ListPrice"), Required: true,
 		Help: `Base price for computation.
 - Public Price: The base price will be the Sale/public Price.
 - Cost Price : The base price will be the cost price.
-- Other Pricelist : Computation of the base price based on another Pricelist.`,
+- Other Pricelist : Computation of the base price based on another Pricelist.
+- Kit Components : The base price of kits is the sum of the prices of their components in this pricelist.
+  The public price is used for other products.`,
 		Constraint: h.ProductPricelistItem().Methods().CheckOtherList()},
 	"BasePricelist": fields.Many2One{String: "Other Pricelist", RelationModel: h.ProductPricelist(),
 		Constraint: h.ProductPricelistItem().Methods().CheckOtherList()},
@@ -11,6 +11,7 @@ import (
 	"github.com/gleke/hexya/src/models/types"
 	"github.com/gleke/hexya/src/models/types/dates"
 	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -127,3 +128,81 @@ func TestProductPriceList(t *testing.T) {
 		}), ShouldBeNil)
 	})
 }
+
+func TestKits(t *testing.T) {
+	Convey("Testing kits priced from their components", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			board := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Board").
+				SetListPrice(20).
+				SetStandardPrice(8).
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit)).ProductVariant()
+			screw := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Screw").
+				SetListPrice(1).
+				SetStandardPrice(0.5).
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit)).ProductVariant()
+			kit := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Shelf Kit").
+				SetListPrice(50).
+				SetIsKit(true).
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit).
+				CreateKitLines(h.ProductKitLine().NewData().
+					SetProduct(board).
+					SetQuantity(2)).
+				CreateKitLines(h.ProductKitLine().NewData().
+					SetProduct(screw).
+					SetQuantity(1).
+					SetUom(ptd.uomDozen)))
+			Convey("The cost of a kit is the cost of its components", func() {
+				So(kit.KitCost(), ShouldAlmostEqual, 22)
+				So(kit.StandardPrice(), ShouldAlmostEqual, 22)
+				So(kit.ProductVariant().LstPrice(), ShouldAlmostEqual, 50)
+			})
+			Convey("The cost of the kit variant follows its components", func() {
+				So(kit.ProductVariant().StandardPrice(), ShouldAlmostEqual, 22)
+				board.SetStandardPrice(10)
+				So(kit.ProductVariant().StandardPrice(), ShouldAlmostEqual, 26)
+				kit.KitLines().Filtered(func(r m.ProductKitLineSet) bool {
+					return r.Product().Equals(screw)
+				}).Unlink()
+				So(kit.ProductVariant().StandardPrice(), ShouldAlmostEqual, 20)
+			})
+			Convey("The sale price of a kit can come from its components", func() {
+				kit.SetKitListPrice(true)
+				So(kit.KitPrice(), ShouldAlmostEqual, 52)
+				So(kit.ProductVariant().LstPrice(), ShouldAlmostEqual, 52)
+			})
+			Convey("Pricelists can price kits from the prices of their components", func() {
+				pricelist := h.ProductPricelist().Create(env, h.ProductPricelist().NewData().
+					SetName("Kit pricelist"))
+				h.ProductPricelistItem().Create(env, h.ProductPricelistItem().NewData().
+					SetPricelist(pricelist).
+					SetComputePrice("percentage").
+					SetPercentPrice(10).
+					SetProductTmpl(board.ProductTmpl()).
+					SetAppliedOn("1_product"))
+				h.ProductPricelistItem().Create(env, h.ProductPricelistItem().NewData().
+					SetPricelist(pricelist).
+					SetComputePrice("formula").
+					SetBase("kit").
+					SetProductTmpl(kit).
+					SetAppliedOn("1_product"))
+				partner := h.Partner().NewSet(env)
+				So(pricelist.GetProductPrice(kit.ProductVariant(), 1, partner, dates.Today(), ptd.uomUnit),
+					ShouldAlmostEqual, 48)
+			})
+			Convey("A kit cannot contain itself", func() {
+				So(func() {
+					h.ProductKitLine().Create(env, h.ProductKitLine().NewData().
+						SetKitTmpl(board.ProductTmpl()).
+						SetProduct(kit.ProductVariant()))
+				}, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
@@ -4,8 +4,11 @@
 package product
 
 import (
+	"fmt"
 	"github.com/gleke/hexya/src/models/fields"
 	"log"
+	"sort"
+	"strings"
 
 	"github.com/gleke/base"
 	"github.com/gleke/decimalPrecision"
@@ -18,6 +21,7 @@ import (
 	"github.com/gleke/pool/h"
 	"github.com/gleke/pool/m"
 	"github.com/gleke/pool/q"
+	"github.com/gleke/product/productvariants"
 )
 
 var fields_ProductTemplate = map[string]models.FieldDefinition{
@@ -71,21 +75,53 @@ This description will be copied to every Sale Order, Delivery Order and Customer
 		Digits: decimalPrecision.GetPrecision("Product Price")},
 	"StandardPrice": fields.Float{String: "Cost",
 		Compute: h.ProductTemplate().Methods().ComputeStandardPrice(),
-		Depends: []string{"ProductVariants", "ProductVariants.StandardPrice"},
+		Depends: []string{"ProductVariants", "ProductVariants.StandardPrice", "VariantSummary", "IsKit", "KitLines"},
 		Inverse: h.ProductTemplate().Methods().InverseStandardPrice(),
 		Digits:  decimalPrecision.GetPrecision("Product Price"),
 		InvisibleFunc: func(env models.Environment) (bool, models.Conditioner) {
 			return !security.Registry.HasMembership(env.Uid(), base.GroupUser), nil
 		},
 		Help: "Cost of the product, in the default unit of measure of the product."},
+	"ReferenceVolume": fields.Float{String: "Volume (m³)",
+		Compute: h.ProductTemplate().Methods().ComputeReferenceMeasures(), Stored: true,
+		Depends: []string{"ProductVariants", "ProductVariants.Volume", "VariantSummary"},
+		Help:    "The volume in the reference volume unit of measure (m³), used to search, sort and group products."},
 	"Volume": fields.Float{Compute: h.ProductTemplate().Methods().ComputeVolume(),
-		Depends: []string{"ProductVariants", "ProductVariants.Volume"},
-		Inverse: h.ProductTemplate().Methods().InverseVolume(), Help: "The volume in m3.", Stored: true},
+		Depends: []string{"ReferenceVolume"},
+		Inverse: h.ProductTemplate().Methods().InverseVolume(),
+		Help:    "The volume, expressed in the volume unit of measure of the company (m³ by default)."},
+	"VolumeUomName": fields.Char{String: "Volume unit of measure label",
+		Compute: h.ProductTemplate().Methods().ComputeUomNames()},
+	"ReferenceWeight": fields.Float{String: "Weight (kg)",
+		Compute: h.ProductTemplate().Methods().ComputeReferenceMeasures(), Stored: true,
+		Depends: []string{"ProductVariants", "ProductVariants.Weight", "VariantSummary"},
+		Digits:  decimalPrecision.GetPrecision("Stock Weight"),
+		Help:    "The weight in the reference weight unit of measure (kg), used to search, sort and group products."},
 	"Weight": fields.Float{Compute: h.ProductTemplate().Methods().ComputeWeight(),
-		Depends: []string{"ProductVariants", "ProductVariants.Weight"},
+		Depends: []string{"ReferenceWeight"},
 		Inverse: h.ProductTemplate().Methods().InverseWeight(),
-		Digits:  decimalPrecision.GetPrecision("Stock Weight"), Stored: true,
-		Help: "The weight of the contents in Kg, not including any packaging, etc."},
+		Digits:  decimalPrecision.GetPrecision("Stock Weight"),
+		Help: `The weight of the contents, not including any packaging, etc.
+Expressed in the weight unit of measure of the company (kg by default).`},
+	"WeightUomName": fields.Char{String: "Weight unit of measure label",
+		Compute: h.ProductTemplate().Methods().ComputeUomNames()},
+	"Length": fields.Float{Compute: h.ProductTemplate().Methods().ComputeDimensions(),
+		Depends: []string{"ProductVariants", "ProductVariants.Length"},
+		Inverse: h.ProductTemplate().Methods().InverseLength(),
+		Help:    "The length of the product, expressed in the dimensional unit of measure."},
+	"Width": fields.Float{Compute: h.ProductTemplate().Methods().ComputeDimensions(),
+		Depends: []string{"ProductVariants", "ProductVariants.Width"},
+		Inverse: h.ProductTemplate().Methods().InverseWidth(),
+		Help:    "The width of the product, expressed in the dimensional unit of measure."},
+	"Height": fields.Float{Compute: h.ProductTemplate().Methods().ComputeDimensions(),
+		Depends: []string{"ProductVariants", "ProductVariants.Height"},
+		Inverse: h.ProductTemplate().Methods().InverseHeight(),
+		Help:    "The height of the product, expressed in the dimensional unit of measure."},
+	"DimensionalUom": fields.Many2One{String: "Dimensional UoM", RelationModel: h.ProductUom(),
+		Compute: h.ProductTemplate().Methods().ComputeDimensions(),
+		Depends: []string{"ProductVariants", "ProductVariants.DimensionalUom"},
+		Inverse: h.ProductTemplate().Methods().InverseDimensionalUom(),
+		Help:    "Unit of measure of the length, width and height of the product."},
 	"Warranty": fields.Float{},
 	"SaleOk": fields.Boolean{String: "Can be Sold", Default: models.DefaultValue(true),
 		Help: "Specify if the product can be selected in a sales order line."},
@@ -106,7 +142,7 @@ This description will be copied to every Sale Order, Delivery Order and Customer
 	"Company": fields.Many2One{String: "Company", RelationModel: h.Company(),
 		Default: func(env models.Environment) interface{} {
 			return h.ProductUom().NewSet(env).SearchAll().Limit(1).OrderBy("ID")
-		}, Index: true},
+		}, Index: true, Constraint: h.ProductTemplate().Methods().CheckBarcode()},
 	"Packagings": fields.One2Many{String: "Logistical Units", RelationModel: h.ProductPackaging(),
 		ReverseFK: "ProductTmpl", JSON: "packaging_ids",
 		Help: `Gives the different ways to package the same product. This has no impact on
@@ -114,10 +150,14 @@ This description will be copied to every Sale Order, Delivery Order and Customer
 	"Sellers": fields.One2Many{String: "Vendors", RelationModel: h.ProductSupplierinfo(),
 		ReverseFK: "ProductTmpl", JSON: "seller_ids"},
 	"Active": fields.Boolean{Default: models.DefaultValue(true), Required: true,
-		Help: "If unchecked, it will allow you to hide the product without removing it."},
+		Constraint: h.ProductTemplate().Methods().CheckBarcode(),
+		Help:       "If unchecked, it will allow you to hide the product without removing it."},
 	"Color": fields.Integer{String: "Color Index"},
 	"AttributeLines": fields.One2Many{String: "Product Attributes",
 		RelationModel: h.ProductAttributeLine(), ReverseFK: "ProductTmpl", JSON: "attribute_line_ids"},
+	"AttributeExclusions": fields.One2Many{String: "Attribute Exclusions",
+		RelationModel: h.ProductAttributeExclusion(), ReverseFK: "ProductTmpl", JSON: "attribute_exclusion_ids",
+		Help: "Combinations of attribute values for which no variant is created"},
 	"ProductVariants": fields.One2Many{String: "Products", RelationModel: h.ProductProduct(),
 		ReverseFK: "ProductTmpl", JSON: "product_variant_ids", Required: true},
 	"ProductVariant": fields.Many2One{String: "Product", RelationModel: h.ProductProduct(),
@@ -127,7 +167,7 @@ This description will be copied to every Sale Order, Delivery Order and Customer
 		Compute: h.ProductTemplate().Methods().ComputeProductVariantCount(),
 		Depends: []string{"ProductVariants"}, GoType: new(int)},
 	"Barcode": fields.Char{},
-	"DefaultCode": fields.Char{String: "Internal Reference",
+	"DefaultCode": fields.Char{String: "Internal Reference", NoCopy: true,
 		Compute: h.ProductTemplate().Methods().ComputeDefaultCode(),
 		Depends: []string{"ProductVariants", "ProductVariants.DefaultCode"},
 		Inverse: h.ProductTemplate().Methods().InverseDefaultCode(), Stored: true},
@@ -201,51 +241,150 @@ func product_template_InverseTemplatePrice(rs m.ProductTemplateSet, price float6
 	rs.SetListPrice(price)
 }
 
-//`ComputeStandardPrice returns the standard price for this template`,
+//`ComputeStandardPrice returns the standard price for this template, the cost of its
+//		components if it is a kit, or the average standard price of its variants if its
+//		variant values are displayed as averages`,
 func product_template_ComputeStandardPrice(rs m.ProductTemplateSet) m.ProductTemplateData {
+	if rs.IsKit() {
+		return h.ProductTemplate().NewData().SetStandardPrice(rs.KitCost())
+	}
 	if rs.ProductVariants().Len() == 1 {
 		return h.ProductTemplate().NewData().
 			SetStandardPrice(rs.ProductVariant().StandardPrice())
 	}
+	if rs.VariantSummary() == "average" && rs.ProductVariants().IsNotEmpty() {
+		return h.ProductTemplate().NewData().
+			SetStandardPrice(variantValueRange(rs.ProductVariants(), variantStandardPrice).Average)
+	}
 	return h.ProductTemplate().NewData()
 }
 
-//`InverseStandardPrice sets this template's standard price`,
+//`InverseStandardPrice sets the standard price of all the variants of this template.`,
 func product_template_InverseStandardPrice(rs m.ProductTemplateSet, price float64) {
-	if rs.ProductVariants().Len() == 1 {
-		rs.ProductVariant().SetStandardPrice(price)
+	if rs.ProductVariants().IsNotEmpty() {
+		rs.ProductVariants().SetStandardPrice(price)
+	}
+}
+
+//`GetWeightUom returns the unit of measure in which weights are entered and displayed.
+//		This is the weight UoM of the company given by 'force_company' in the context, or
+//		of the current user's company.`,
+func product_template_GetWeightUom(rs m.ProductTemplateSet) m.ProductUomSet {
+	company := h.Company().NewSet(rs.Env()).CompanyDefaultGet()
+	if rs.Env().Context().HasKey("force_company") {
+		company = h.Company().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("force_company")})
 	}
+	return company.GetWeightUom()
 }
 
-//`ComputeVolume compute the volume of this template`,
+//`GetVolumeUom returns the unit of measure in which volumes are entered and displayed.
+//		This is the volume UoM of the company given by 'force_company' in the context, or
+//		of the current user's company.`,
+func product_template_GetVolumeUom(rs m.ProductTemplateSet) m.ProductUomSet {
+	company := h.Company().NewSet(rs.Env()).CompanyDefaultGet()
+	if rs.Env().Context().HasKey("force_company") {
+		company = h.Company().Browse(rs.Env(), []int64{rs.Env().Context().GetInteger("force_company")})
+	}
+	return company.GetVolumeUom()
+}
+
+//`ComputeUomNames returns the labels of the weight and volume units of measure`,
+func product_template_ComputeUomNames(rs m.ProductTemplateSet) m.ProductTemplateData {
+	return h.ProductTemplate().NewData().
+		SetWeightUomName(rs.GetWeightUom().Name()).
+		SetVolumeUomName(rs.GetVolumeUom().Name())
+}
+
+//`ComputeReferenceMeasures computes the weight and volume of this template in the reference
+//		UoMs from its variant, or the average of its variants if its variant values are displayed
+//		as averages`,
+func product_template_ComputeReferenceMeasures(rs m.ProductTemplateSet) m.ProductTemplateData {
+	res := h.ProductTemplate().NewData().SetReferenceWeight(0).SetReferenceVolume(0)
+	variants := rs.ProductVariants()
+	switch {
+	case variants.Len() == 1:
+		res.SetReferenceWeight(variants.Weight()).SetReferenceVolume(variants.Volume())
+	case rs.VariantSummary() == "average" && variants.IsNotEmpty():
+		res.SetReferenceWeight(variantValueRange(variants, func(r m.ProductProductSet) float64 {
+			return r.Weight()
+		}).Average).SetReferenceVolume(variantValueRange(variants, func(r m.ProductProductSet) float64 {
+			return r.Volume()
+		}).Average)
+	}
+	return res
+}
+
+//`ComputeVolume computes the volume of this template in the company's volume UoM from its
+//		volume in the reference UoM`,
 func product_template_ComputeVolume(rs m.ProductTemplateSet) m.ProductTemplateData {
+	refUom := h.ProductUom().NewSet(rs.Env()).GetReferenceVolumeUom()
+	return h.ProductTemplate().NewData().
+		SetVolume(refUom.ComputeQuantity(rs.ReferenceVolume(), rs.GetVolumeUom(), false))
+}
+
+//`InverseVolume sets the volume of all the variants of this template from a value in the
+//		company's volume UoM.`,
+func product_template_InverseVolume(rs m.ProductTemplateSet, volume float64) {
+	if rs.ProductVariants().IsNotEmpty() {
+		refUom := h.ProductUom().NewSet(rs.Env()).GetReferenceVolumeUom()
+		rs.ProductVariants().SetVolume(rs.GetVolumeUom().ComputeQuantity(volume, refUom, false))
+	}
+}
+
+//`ComputeWeight computes the weight of this template in the company's weight UoM from its
+//		weight in the reference UoM`,
+func product_template_ComputeWeight(rs m.ProductTemplateSet) m.ProductTemplateData {
+	refUom := h.ProductUom().NewSet(rs.Env()).GetReferenceWeightUom()
+	return h.ProductTemplate().NewData().
+		SetWeight(refUom.ComputeQuantity(rs.ReferenceWeight(), rs.GetWeightUom(), false))
+}
+
+//`InverseWeight sets the weight of all the variants of this template from a value in the
+//		company's weight UoM.`,
+func product_template_InverseWeight(rs m.ProductTemplateSet, weight float64) {
+	if rs.ProductVariants().IsNotEmpty() {
+		refUom := h.ProductUom().NewSet(rs.Env()).GetReferenceWeightUom()
+		rs.ProductVariants().SetWeight(rs.GetWeightUom().ComputeQuantity(weight, refUom, false))
+	}
+}
+
+//`ComputeDimensions computes the dimensions of this template from its variant`,
+func product_template_ComputeDimensions(rs m.ProductTemplateSet) m.ProductTemplateData {
 	if rs.ProductVariants().Len() == 1 {
 		return h.ProductTemplate().NewData().
-			SetVolume(rs.ProductVariant().Volume())
+			SetLength(rs.ProductVariant().Length()).
+			SetWidth(rs.ProductVariant().Width()).
+			SetHeight(rs.ProductVariant().Height()).
+			SetDimensionalUom(rs.ProductVariant().DimensionalUom())
 	}
 	return h.ProductTemplate().NewData()
 }
 
-//`InverseVolume sets this template's volume`,
-func product_template_InverseVolume(rs m.ProductTemplateSet, volume float64) {
+//`InverseLength sets this template's length`,
+func product_template_InverseLength(rs m.ProductTemplateSet, length float64) {
 	if rs.ProductVariants().Len() == 1 {
-		rs.ProductVariant().SetVolume(volume)
+		rs.ProductVariant().SetLength(length)
 	}
 }
 
-//`ComputeWeight compute the weight of this template`,
-func product_template_ComputeWeight(rs m.ProductTemplateSet) m.ProductTemplateData {
+//`InverseWidth sets this template's width`,
+func product_template_InverseWidth(rs m.ProductTemplateSet, width float64) {
 	if rs.ProductVariants().Len() == 1 {
-		return h.ProductTemplate().NewData().
-			SetWeight(rs.ProductVariant().Weight())
+		rs.ProductVariant().SetWidth(width)
 	}
-	return h.ProductTemplate().NewData()
 }
 
-//`InverseWeightsets this template's weight`,
-func product_template_InverseWeight(rs m.ProductTemplateSet, weight float64) {
+//`InverseHeight sets this template's height`,
+func product_template_InverseHeight(rs m.ProductTemplateSet, height float64) {
 	if rs.ProductVariants().Len() == 1 {
-		rs.ProductVariant().SetWeight(weight)
+		rs.ProductVariant().SetHeight(height)
+	}
+}
+
+//`InverseDimensionalUom sets the unit of measure of this template's dimensions`,
+func product_template_InverseDimensionalUom(rs m.ProductTemplateSet, uom m.ProductUomSet) {
+	if rs.ProductVariants().Len() == 1 {
+		rs.ProductVariant().SetDimensionalUom(uom)
 	}
 }
 
@@ -319,6 +458,7 @@ func product_template_Create(rs m.ProductTemplateSet, data m.ProductTemplateData
 	if data.HasDefaultCode() {
 		relatedVals.SetDefaultCode(data.DefaultCode())
 	}
+	// The cost, volume and weight of a template apply to all its variants
 	if data.HasStandardPrice() {
 		relatedVals.SetStandardPrice(data.StandardPrice())
 	}
@@ -328,14 +468,28 @@ func product_template_Create(rs m.ProductTemplateSet, data m.ProductTemplateData
 	if data.HasWeight() {
 		relatedVals.SetWeight(data.Weight())
 	}
+	if data.HasDimensionalUom() {
+		relatedVals.SetDimensionalUom(data.DimensionalUom())
+	}
+	if data.HasLength() {
+		relatedVals.SetLength(data.Length())
+	}
+	if data.HasWidth() {
+		relatedVals.SetWidth(data.Width())
+	}
+	if data.HasHeight() {
+		relatedVals.SetHeight(data.Height())
+	}
 	template.Write(relatedVals)
+	template.ProductVariants().GenerateDefaultCode()
 	return template
 }
 
 func product_template_Write(rs m.ProductTemplateSet, vals m.ProductTemplateData) bool {
 	rs.ResizeImageData(vals)
 	res := rs.Super().Write(vals)
-	if vals.HasAttributeLines() || vals.Active() {
+	userTemplateCode := vals.HasTemplateCode() && !rs.Env().Context().HasKey("generated_template_code")
+	if vals.HasAttributeLines() || vals.HasAttributeExclusions() || vals.Active() || vals.HasSkuPattern() || userTemplateCode {
 		rs.CreateVariants()
 	}
 	if vals.HasActive() && !vals.Active() {
@@ -416,7 +570,188 @@ func product_template_PriceCompute(rs m.ProductTemplateSet, priceType models.Fie
 	return price
 }
 
-//`CreateVariants`,
+//`IsCombinationPossible returns true if the given attribute values can be combined
+//		in a variant of this template, i.e. if no exclusion of this template forbids it.`,
+func product_template_IsCombinationPossible(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) bool {
+	rs.EnsureOne()
+	return rs.VariantExclusions().Allows(values.Ids())
+}
+
+//`VariantLines returns the IDs of the values of each attribute line of this template
+//		that creates variants.`,
+func product_template_VariantLines(rs m.ProductTemplateSet) [][]int64 {
+	rs.EnsureOne()
+	var lines [][]int64
+	for _, line := range rs.AttributeLines().Records() {
+		if !line.Attribute().CreateVariant() {
+			continue
+		}
+		lines = append(lines, line.Values().Ids())
+	}
+	return lines
+}
+
+//`VariantExclusions returns the exclusions of this template on value IDs`,
+func product_template_VariantExclusions(rs m.ProductTemplateSet) productvariants.Exclusions {
+	rs.EnsureOne()
+	exclusions := make(productvariants.Exclusions)
+	for _, exclusion := range rs.AttributeExclusions().Records() {
+		exclusions.Add(exclusion.Value().ID(), exclusion.ExcludedValues().Ids()...)
+	}
+	return exclusions
+}
+
+//`GetVariantLimit returns the maximum number of variants that can be generated for this
+//		template, as set on its company or on the current company. 0 means no limit.`,
+func product_template_GetVariantLimit(rs m.ProductTemplateSet) int {
+	company := rs.Company()
+	if company.IsEmpty() {
+		company = h.Company().NewSet(rs.Env()).CompanyDefaultGet()
+	}
+	return int(company.VariantLimit())
+}
+
+//`HasDynamicAttributes returns true if this template has an attribute whose variants
+//		are only created when they are requested.`,
+func product_template_HasDynamicAttributes(rs m.ProductTemplateSet) bool {
+	rs.EnsureOne()
+	for _, line := range rs.AttributeLines().Records() {
+		if line.Attribute().CreateVariantMode() == "dynamic" {
+			return true
+		}
+	}
+	return false
+}
+
+//`VariantValues returns the given attribute values without the values of
+//		attributes that never create variants.`,
+func product_template_VariantValues(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) m.ProductAttributeValueSet {
+	return values.Filtered(func(r m.ProductAttributeValueSet) bool {
+		return r.Attribute().CreateVariant()
+	})
+}
+
+//`IsCombinationValid returns true if the given attribute values define a variant
+//		of this template, i.e. if they hold exactly one value of each attribute line
+//		creating variants and if no exclusion forbids their combination.`,
+func product_template_IsCombinationValid(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) bool {
+	rs.EnsureOne()
+	return productvariants.IsValid(rs.VariantLines(), rs.VariantExclusions(), rs.VariantValues(values).Ids())
+}
+
+//`GetOrCreateVariant returns the variant of this template with the given attribute values,
+//		creating it if it does not exist yet or reactivating it if it is archived.
+//		Values of attributes that never create variants are ignored.
+//		It panics if the given values do not define a valid variant of this template.`,
+func product_template_GetOrCreateVariant(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) m.ProductProductSet {
+	rs.EnsureOne()
+	values = rs.VariantValues(values)
+	if !rs.IsCombinationValid(values) {
+		log.Panic(rs.T("Error: The given attribute values do not define a valid variant of %s.", rs.Name()))
+	}
+	if variant := rs.FindVariant(values); variant.IsNotEmpty() {
+		if !variant.Active() {
+			variant.SetActive(true)
+		}
+		return variant
+	}
+	return h.ProductProduct().Create(rs.Env(), h.ProductProduct().NewData().
+		SetProductTmpl(rs).
+		SetAttributeValues(values))
+}
+
+//`GetCombinationPriceExtra returns the sum of the price extras of the given attribute values
+//		for this template. The combination does not need to exist as a variant.`,
+func product_template_GetCombinationPriceExtra(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) float64 {
+	rs.EnsureOne()
+	return rs.GetValuePriceExtra(values)
+}
+
+//`GetCombinationPrice returns the sale price of the given combination of attribute values
+//		of this template, including the price extras of the values. The combination
+//		does not need to exist as a variant.`,
+func product_template_GetCombinationPrice(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) float64 {
+	rs.EnsureOne()
+	return rs.ListPrice() + rs.GetCombinationPriceExtra(values)
+}
+
+//`CreateCombinationVariants creates a variant of this template for each of the given
+//		combinations of attribute value IDs and returns them. The first variant is created
+//		through the ORM so that it gets all its default values. The others are copies of its
+//		row inserted in a single query, and their attribute values are linked in another one.
+//		The internal references of the new variants are generated once they are all created.`,
+func product_template_CreateCombinationVariants(rs m.ProductTemplateSet, combinations [][]int64) m.ProductProductSet {
+	rs.EnsureOne()
+	if len(combinations) == 0 {
+		return h.ProductProduct().NewSet(rs.Env())
+	}
+	firstVariant := rs.WithContext("active_test", false).ProductVariants().IsEmpty()
+	// Creating from the template skips the checks each variant would do on all its siblings
+	res := h.ProductProduct().NewSet(rs.Env()).WithContext("create_from_tmpl", true).Create(h.ProductProduct().NewData().
+		SetProductTmpl(rs).
+		SetAttributeValues(h.ProductAttributeValue().Browse(rs.Env(), combinations[0])))
+	if len(combinations) > 1 {
+		copies := insertVariantCopies(res, combinations[1:])
+		// Writing the measures of the copies recomputes the template fields that depend on its variants
+		copies.Write(h.ProductProduct().NewData().
+			SetWeight(res.Weight()).
+			SetVolume(res.Volume()))
+		rs.Collection().InvalidateCache()
+		res = res.Union(copies)
+	}
+	if rs.Env().Context().HasKey("create_from_tmpl") {
+		// Template creation sets the references and prices of its variants itself
+		return res
+	}
+	if firstVariant && len(combinations) == 1 {
+		res.DefineStandardPrice(0)
+	}
+	res.GenerateDefaultCode()
+	return res
+}
+
+// insertVariantCopies inserts a copy of the given variant for each of the given combinations
+// of attribute value IDs and links the copies to their values. Unique columns are left empty.
+func insertVariantCopies(variant m.ProductProductSet, combinations [][]int64) m.ProductProductSet {
+	table := h.ProductProduct().TableName()
+	var columns []string
+	variant.Env().Cr().Select(&columns, `
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ?
+			AND column_name NOT IN ('id', 'hexya_external_id', 'barcode', 'default_code')`, table)
+	for i, column := range columns {
+		columns[i] = fmt.Sprintf("%q", column)
+	}
+	cols := strings.Join(columns, ", ")
+	var ids []int64
+	variant.Env().Cr().Select(&ids, fmt.Sprintf(`
+		INSERT INTO %[1]s (hexya_external_id, %[2]s)
+		SELECT hexya_external_id || '_' || s.i, %[2]s
+		FROM %[1]s, generate_series(1, ?) AS s(i)
+		WHERE id = ?
+		ORDER BY s.i
+		RETURNING id`, table, cols), len(combinations), variant.ID())
+	// Identifiers are allocated in insertion order
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var links []string
+	for i, combination := range combinations {
+		for _, valueID := range combination {
+			links = append(links, fmt.Sprintf("(%d, %d)", ids[i], valueID))
+		}
+	}
+	if len(links) > 0 {
+		variant.Env().Cr().Execute(fmt.Sprintf(`
+			INSERT INTO %s (product_product_id, product_attribute_value_id) VALUES %s`,
+			models.Registry.MustGet("ProductAttributeValueProductProductRel").TableName(),
+			strings.Join(links, ", ")))
+	}
+	return h.ProductProduct().Browse(variant.Env(), ids)
+}
+
+//`CreateVariants creates the missing variants of the templates of this set and archives or
+//		deletes the variants that do not match their attribute lines anymore. Combinations are
+//		compared on value IDs so that large matrices are processed quickly. It panics if a
+//		template would have more variants than the variant limit of its company.`,
 func product_template_CreateVariants(rs m.ProductTemplateSet) {
 	for _, tmpl := range rs.WithContext("active_test", false).Records() {
 		// adding an attribute with only one value should not recreate product
@@ -438,87 +773,60 @@ func product_template_CreateVariants(rs m.ProductTemplateSet) {
 			}
 		}
 
-		// list of values combination
-		var existingVariants []m.ProductAttributeValueSet
+		// values combination of each existing product
+		createsVariant := make(map[int64]bool)
+		existing := make(map[int64][]int64)
 		for _, prod := range tmpl.ProductVariants().Records() {
-			prodVariant := h.ProductAttributeValue().NewSet(rs.Env())
+			var ids []int64
 			for _, attrVal := range prod.AttributeValues().Records() {
-				if attrVal.Attribute().CreateVariant() {
-					prodVariant = prodVariant.Union(attrVal)
+				creates, ok := createsVariant[attrVal.ID()]
+				if !ok {
+					creates = attrVal.Attribute().CreateVariant()
+					createsVariant[attrVal.ID()] = creates
 				}
-			}
-			existingVariants = append(existingVariants, prodVariant)
-		}
-		var matrixValues []m.ProductAttributeValueSet
-		for _, attrLine := range tmpl.AttributeLines().Records() {
-			if !attrLine.Attribute().CreateVariant() {
-				continue
-			}
-			matrixValues = append(matrixValues, attrLine.Values())
-		}
-		var variantMatrix []m.ProductAttributeValueSet
-		if len(matrixValues) > 0 {
-			variantMatrix = matrixValues[0].CartesianProduct(matrixValues[1:]...)
-		} else {
-			variantMatrix = []m.ProductAttributeValueSet{h.ProductAttributeValue().NewSet(rs.Env())}
-		}
-
-		var toCreateVariants []m.ProductAttributeValueSet
-		for _, mVariant := range variantMatrix {
-			var exists bool
-			for _, eVariant := range existingVariants {
-				if mVariant.Equals(eVariant) {
-					exists = true
-					break
+				if creates {
+					ids = append(ids, attrVal.ID())
 				}
 			}
-			if !exists {
-				toCreateVariants = append(toCreateVariants, mVariant)
-			}
+			existing[prod.ID()] = ids
 		}
-
-		// check product
-		variantsToActivate := h.ProductProduct().NewSet(rs.Env())
-		variantsToUnlink := h.ProductProduct().NewSet(rs.Env())
-		for _, product := range tmpl.ProductVariants().Records() {
-			tcAttrs := h.ProductAttributeValue().NewSet(rs.Env())
-			for _, attrVal := range product.AttributeValues().Records() {
-				if !attrVal.Attribute().CreateVariant() {
-					continue
+		lines := tmpl.VariantLines()
+		exclusions := tmpl.VariantExclusions()
+
+		var diff productvariants.Diff
+		if tmpl.HasDynamicAttributes() {
+			// templates with dynamic attributes only get their variants on demand
+			for id, ids := range existing {
+				if !productvariants.IsValid(lines, exclusions, ids) {
+					diff.Remove = append(diff.Remove, id)
 				}
-				tcAttrs = tcAttrs.Union(attrVal)
 			}
-			var inMatrix bool
-			for _, mVariant := range variantMatrix {
-				if tcAttrs.Equals(mVariant) {
-
-					inMatrix = true
-					break
-				}
+		} else {
+			matrix, err := productvariants.Matrix(lines, exclusions, tmpl.GetVariantLimit())
+			if err != nil {
+				log.Panic(rs.T(`Error: The product %s would have more than %d variants.
+Remove attribute values, exclude impossible combinations, use dynamic variants or raise the variant limit of the company.`,
+					tmpl.Name(), tmpl.GetVariantLimit()))
 			}
-			switch {
-			case inMatrix && !product.Active():
-				variantsToActivate = variantsToActivate.Union(product)
-			case !inMatrix:
-				variantsToUnlink = variantsToUnlink.Union(product)
+			diff = productvariants.Compare(matrix, existing)
+			variantsToActivate := h.ProductProduct().Browse(rs.Env(), diff.Keep).Filtered(func(r m.ProductProductSet) bool {
+				return !r.Active()
+			})
+			if !variantsToActivate.IsEmpty() {
+				variantsToActivate.SetActive(true)
 			}
 		}
-		if !variantsToActivate.IsEmpty() {
-			variantsToActivate.SetActive(true)
-		}
 
 		// create new product
-		for _, variants := range toCreateVariants {
-			h.ProductProduct().Create(rs.Env(), h.ProductProduct().NewData().
-				SetProductTmpl(tmpl).
-				SetAttributeValues(variants))
-		}
+		tmpl.CreateCombinationVariants(diff.Create)
 
 		// unlink or inactive product
-		if !variantsToUnlink.IsEmpty() {
-			variantsToUnlink.UnlinkOrDeactivate()
+		if len(diff.Remove) > 0 {
+			h.ProductProduct().Browse(rs.Env(), diff.Remove).UnlinkOrDeactivate()
 		}
 
+		// regenerate references from the SKU pattern
+		tmpl.ApplySkuPattern()
 	}
 }
 
@@ -535,12 +843,22 @@ func init() {
 	h.ProductTemplate().NewMethod("InverseTemplatePrice", product_template_InverseTemplatePrice)
 	h.ProductTemplate().NewMethod("ComputeStandardPrice", product_template_ComputeStandardPrice)
 	h.ProductTemplate().NewMethod("InverseStandardPrice", product_template_InverseStandardPrice)
+	h.ProductTemplate().NewMethod("GetWeightUom", product_template_GetWeightUom)
+	h.ProductTemplate().NewMethod("GetVolumeUom", product_template_GetVolumeUom)
+	h.ProductTemplate().NewMethod("ComputeUomNames", product_template_ComputeUomNames)
+	h.ProductTemplate().NewMethod("ComputeReferenceMeasures", product_template_ComputeReferenceMeasures)
 	h.ProductTemplate().NewMethod("ComputeVolume", product_template_ComputeVolume)
 
 	h.ProductTemplate().NewMethod("InverseVolume", product_template_InverseVolume)
 	h.ProductTemplate().NewMethod("ComputeWeight", product_template_ComputeWeight)
 	h.ProductTemplate().NewMethod("InverseWeight", product_template_InverseWeight)
 
+	h.ProductTemplate().NewMethod("ComputeDimensions", product_template_ComputeDimensions)
+	h.ProductTemplate().NewMethod("InverseLength", product_template_InverseLength)
+	h.ProductTemplate().NewMethod("InverseWidth", product_template_InverseWidth)
+	h.ProductTemplate().NewMethod("InverseHeight", product_template_InverseHeight)
+	h.ProductTemplate().NewMethod("InverseDimensionalUom", product_template_InverseDimensionalUom)
+
 	h.ProductTemplate().NewMethod("ComputeProductVariantCount", product_template_ComputeProductVariantCount)
 
 	h.ProductTemplate().NewMethod("ComputeDefaultCode", product_template_ComputeDefaultCode)
@@ -557,6 +875,17 @@ func init() {
 
 	h.ProductTemplate().NewMethod("PriceCompute", product_template_PriceCompute)
 
+	h.ProductTemplate().NewMethod("IsCombinationPossible", product_template_IsCombinationPossible)
+	h.ProductTemplate().NewMethod("VariantLines", product_template_VariantLines)
+	h.ProductTemplate().NewMethod("VariantExclusions", product_template_VariantExclusions)
+	h.ProductTemplate().NewMethod("GetVariantLimit", product_template_GetVariantLimit)
+	h.ProductTemplate().NewMethod("HasDynamicAttributes", product_template_HasDynamicAttributes)
+	h.ProductTemplate().NewMethod("VariantValues", product_template_VariantValues)
+	h.ProductTemplate().NewMethod("IsCombinationValid", product_template_IsCombinationValid)
+	h.ProductTemplate().NewMethod("GetOrCreateVariant", product_template_GetOrCreateVariant)
+	h.ProductTemplate().NewMethod("GetCombinationPriceExtra", product_template_GetCombinationPriceExtra)
+	h.ProductTemplate().NewMethod("GetCombinationPrice", product_template_GetCombinationPrice)
+	h.ProductTemplate().NewMethod("CreateCombinationVariants", product_template_CreateCombinationVariants)
 	h.ProductTemplate().NewMethod("CreateVariants", product_template_CreateVariants)
 
 }
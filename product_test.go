@@ -0,0 +1,67 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/hexya/src/models/types/dates"
+	"github.com/gleke/pool/h"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVariantsFixedSalePrice(t *testing.T) {
+	Convey("Testing fixed sale prices of variants", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Bench").
+				SetListPrice(100).
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit).
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(ptd.prodAtt1).
+					SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))))
+			template.SetValuePriceExtra(ptd.prodAttr1V2, 10, "")
+			variant1 := template.FindVariant(ptd.prodAttr1V1)
+			variant2 := template.FindVariant(ptd.prodAttr1V2)
+			Convey("Setting the sale price of a variant does not change its siblings", func() {
+				variant2.SetLstPrice(150)
+				So(variant2.UseFixedSalePrice(), ShouldBeTrue)
+				So(variant2.FixedSalePrice(), ShouldEqual, 150)
+				So(variant2.LstPrice(), ShouldEqual, 150)
+				So(template.ListPrice(), ShouldEqual, 100)
+				So(variant1.LstPrice(), ShouldEqual, 100)
+				variant2.SetUseFixedSalePrice(false)
+				So(variant2.LstPrice(), ShouldEqual, 110)
+			})
+			Convey("Fixed sale prices are used by pricelists", func() {
+				variant2.SetLstPrice(150)
+				pricelist := h.ProductPricelist().Create(env, h.ProductPricelist().NewData().
+					SetName("Bench pricelist"))
+				h.ProductPricelistItem().Create(env, h.ProductPricelistItem().NewData().
+					SetPricelist(pricelist).
+					SetComputePrice("percentage").
+					SetPercentPrice(10).
+					SetProductTmpl(template).
+					SetAppliedOn("1_product"))
+				partner := h.Partner().NewSet(env)
+				So(pricelist.GetProductPrice(variant2, 1, partner, dates.Today(), ptd.uomUnit), ShouldAlmostEqual, 135)
+				So(pricelist.GetProductPrice(variant1, 1, partner, dates.Today(), ptd.uomUnit), ShouldAlmostEqual, 90)
+			})
+			Convey("Products without variants still update their template", func() {
+				single := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Stool").
+					SetListPrice(20).
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit))
+				single.ProductVariant().SetLstPrice(25)
+				So(single.ListPrice(), ShouldEqual, 25)
+				So(single.ProductVariant().UseFixedSalePrice(), ShouldBeFalse)
+			})
+		}), ShouldBeNil)
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/gleke/hexya/src/tools/nbutils"
 	"github.com/gleke/pool/h"
 	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
 )
 
 var fields_ProductUomCategory = map[string]models.FieldDefinition{
@@ -92,6 +93,9 @@ func product_uom_ComputeQuantity(rs m.ProductUomSet, qty float64, toUnit m.Produ
 		return qty
 	}
 	rs.EnsureOne()
+	if rs.Equals(toUnit) && !round {
+		return qty
+	}
 	if !rs.Category().Equals(toUnit.Category()) {
 		log.Panic(rs.T("Conversion from Product UoM %s to Default UoM %s is not possible as they both belong to different Category!.", rs.Name(), toUnit.Name()))
 	}
@@ -119,6 +123,38 @@ func product_uom_ComputePrice(rs m.ProductUomSet, price float64, toUnit m.Produc
 	return amount / toUnit.Factor()
 }
 
+//`GetReferenceWeightUom returns the UoM in which product weights are stored (kg)`,
+func product_uom_GetReferenceWeightUom(rs m.ProductUomSet) m.ProductUomSet {
+	return h.ProductUom().Search(rs.Env(), q.ProductUom().HexyaExternalID().Equals("product_product_uom_kgm"))
+}
+
+//`GetReferenceVolumeUom returns the UoM in which product volumes are stored (m³)`,
+func product_uom_GetReferenceVolumeUom(rs m.ProductUomSet) m.ProductUomSet {
+	return h.ProductUom().Search(rs.Env(), q.ProductUom().HexyaExternalID().Equals("product_product_uom_cubic_meter"))
+}
+
+//`GetReferenceLengthUom returns the reference UoM for product dimensions (m)`,
+func product_uom_GetReferenceLengthUom(rs m.ProductUomSet) m.ProductUomSet {
+	return h.ProductUom().Search(rs.Env(), q.ProductUom().HexyaExternalID().Equals("product_product_uom_meter"))
+}
+
+//`ComputeVolume returns the volume in m³ of a box whose dimensions are given in this UoM.
+//		If this UoM is empty, dimensions are considered to be in meters. Returns 0 if one of
+//		the dimensions is 0.`,
+func product_uom_ComputeVolume(rs m.ProductUomSet, length, width, height float64) float64 {
+	if length == 0 || width == 0 || height == 0 {
+		return 0
+	}
+	meter := h.ProductUom().NewSet(rs.Env()).GetReferenceLengthUom()
+	uom := rs
+	if uom.IsEmpty() {
+		uom = meter
+	}
+	return uom.ComputeQuantity(length, meter, false) *
+		uom.ComputeQuantity(width, meter, false) *
+		uom.ComputeQuantity(height, meter, false)
+}
+
 func init() {
 
 	models.NewModel("ProductUomCategory")
@@ -136,6 +172,10 @@ func init() {
 	h.ProductUom().NewMethod("OnchangeUomType", product_uom_OnchangeUomType)
 	h.ProductUom().NewMethod("ComputeQuantity", product_uom_ComputeQuantity)
 	h.ProductUom().NewMethod("ComputePrice", product_uom_ComputePrice)
+	h.ProductUom().NewMethod("GetReferenceWeightUom", product_uom_GetReferenceWeightUom)
+	h.ProductUom().NewMethod("GetReferenceVolumeUom", product_uom_GetReferenceVolumeUom)
+	h.ProductUom().NewMethod("GetReferenceLengthUom", product_uom_GetReferenceLengthUom)
+	h.ProductUom().NewMethod("ComputeVolume", product_uom_ComputeVolume)
 
 	h.ProductUom().Methods().Create().Extend(product_uom_Create)
 	h.ProductUom().Methods().Write().Extend(product_uom_Write)
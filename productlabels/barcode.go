@@ -0,0 +1,165 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package productlabels
+
+import "strings"
+
+// quietZoneModules is the number of blank modules printed on each side of a barcode
+const quietZoneModules = 10
+
+// ean13LeftOdd are the L-code patterns of the EAN-13 digits.
+// G-codes and R-codes are derived from them.
+var ean13LeftOdd = [10]string{
+	"0001101", "0011001", "0010011", "0111101", "0100011",
+	"0110001", "0101111", "0111011", "0110111", "0001011",
+}
+
+// ean13Parities gives, for each first digit of an EAN-13 barcode, the
+// L (odd) or G (even) parity of each digit of the left half.
+var ean13Parities = [10]string{
+	"LLLLLL", "LLGLGG", "LLGGLG", "LLGGGL", "GLLGGL",
+	"GGLLGL", "GLGLLG", "GLGGLL", "GLGLGL", "GLLGLG",
+}
+
+// code128Patterns are the bar and space widths of the Code 128 symbols,
+// indexed by symbol value. The last one is the stop pattern.
+var code128Patterns = [107]string{
+	"212222", "222122", "222221", "121223", "121322", "131222", "122213", "122312", "132212", "221213",
+	"221312", "231212", "112232", "122132", "122231", "113222", "123122", "123221", "223211", "221132",
+	"221231", "213212", "223112", "312131", "311222", "321122", "321221", "312212", "322112", "322211",
+	"212123", "212321", "232121", "111323", "131123", "131321", "112313", "132113", "132311", "211313",
+	"231113", "231311", "112133", "112331", "132131", "113123", "113321", "133121", "313121", "211331",
+	"231131", "213113", "213311", "213131", "311123", "311321", "331121", "312113", "312311", "332111",
+	"314111", "221411", "431111", "111224", "111422", "121124", "121421", "141122", "141221", "112214",
+	"112412", "122114", "122411", "142112", "142211", "241211", "221114", "413111", "241112", "134111",
+	"111242", "121142", "121241", "114212", "124112", "124211", "411212", "421112", "421211", "212141",
+	"214121", "412121", "111143", "111341", "131141", "114113", "114311", "411113", "411311", "113141",
+	"114131", "311141", "411131", "211412", "211214", "211232", "2331112",
+}
+
+// Code 128 special symbol values
+const (
+	code128StartB = 104
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// isDigits returns true if the given string is not empty and only made of digits
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+// isEAN13 returns true if the given barcode is made of 13 digits with a valid check digit
+func isEAN13(barcode string) bool {
+	if len(barcode) != 13 || !isDigits(barcode) {
+		return false
+	}
+	var sum int
+	for i := 0; i < 12; i++ {
+		digit := int(barcode[i] - '0')
+		if i%2 == 1 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return int(barcode[12]-'0') == (10-sum%10)%10
+}
+
+// appendPattern appends the modules of the given 0/1 pattern to modules
+func appendPattern(modules []bool, pattern string) []bool {
+	for _, c := range pattern {
+		modules = append(modules, c == '1')
+	}
+	return modules
+}
+
+// ean13Modules returns the 95 modules of the given EAN-13 barcode, true being a bar.
+// The barcode must be made of 13 digits.
+func ean13Modules(barcode string) []bool {
+	modules := make([]bool, 0, 95)
+	modules = appendPattern(modules, "101")
+	parities := ean13Parities[barcode[0]-'0']
+	for i := 1; i <= 6; i++ {
+		pattern := ean13LeftOdd[barcode[i]-'0']
+		if parities[i-1] == 'G' {
+			pattern = reversePattern(complementPattern(pattern))
+		}
+		modules = appendPattern(modules, pattern)
+	}
+	modules = appendPattern(modules, "01010")
+	for i := 7; i <= 12; i++ {
+		modules = appendPattern(modules, complementPattern(ean13LeftOdd[barcode[i]-'0']))
+	}
+	return appendPattern(modules, "101")
+}
+
+// complementPattern returns the given 0/1 pattern with bars and spaces swapped
+func complementPattern(pattern string) string {
+	res := []byte(pattern)
+	for i, c := range res {
+		if c == '0' {
+			res[i] = '1'
+		} else {
+			res[i] = '0'
+		}
+	}
+	return string(res)
+}
+
+// reversePattern returns the given 0/1 pattern read from right to left
+func reversePattern(pattern string) string {
+	res := []byte(pattern)
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return string(res)
+}
+
+// code128Values returns the Code 128 symbol values encoding the given data, including the
+// start symbol and the check symbol but not the stop symbol. Data made of an even number of
+// digits is encoded with code set C, other data with code set B in which characters outside
+// printable ASCII are replaced by '?'.
+func code128Values(data string) []int {
+	var values []int
+	if isDigits(data) && len(data)%2 == 0 {
+		values = append(values, code128StartC)
+		for i := 0; i < len(data); i += 2 {
+			values = append(values, int(data[i]-'0')*10+int(data[i+1]-'0'))
+		}
+	} else {
+		values = append(values, code128StartB)
+		for _, r := range data {
+			if r < ' ' || r > '~' {
+				r = '?'
+			}
+			values = append(values, int(r-' '))
+		}
+	}
+	check := values[0]
+	for i := 1; i < len(values); i++ {
+		check += i * values[i]
+	}
+	return append(values, check%103)
+}
+
+// code128Modules returns the modules of the Code 128 barcode encoding the given data, true being a bar.
+func code128Modules(data string) []bool {
+	var modules []bool
+	for _, value := range append(code128Values(data), code128Stop) {
+		for i, width := range code128Patterns[value] {
+			for j := 0; j < int(width-'0'); j++ {
+				modules = append(modules, i%2 == 0)
+			}
+		}
+	}
+	return modules
+}
+
+// barcodeModules returns the modules of the given barcode in the given symbology
+func barcodeModules(barcode string, symbology Symbology) []bool {
+	if symbology == SymbologyEAN13 {
+		return ean13Modules(barcode)
+	}
+	return code128Modules(barcode)
+}
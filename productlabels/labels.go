@@ -0,0 +1,136 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+// Package productlabels renders product labels with a barcode, either as PDF
+// label sheets or as ZPL for thermal printers.
+package productlabels
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A Symbology is a barcode encoding
+type Symbology string
+
+// Barcode symbologies supported on labels
+const (
+	// SymbologyAuto prints EAN-13 barcodes when the barcode is a valid EAN-13 and Code 128 otherwise
+	SymbologyAuto Symbology = "auto"
+	// SymbologyEAN13 prints EAN-13 barcodes. Barcodes that are not valid EAN-13 are printed in Code 128.
+	SymbologyEAN13 Symbology = "ean13"
+	// SymbologyCode128 prints Code 128 barcodes
+	SymbologyCode128 Symbology = "code128"
+)
+
+// A Format is an output format of labels
+type Format string
+
+// Label output formats
+const (
+	// FormatPDF renders labels as PDF label sheets
+	FormatPDF Format = "pdf"
+	// FormatZPL renders labels as ZPL commands for thermal printers
+	FormatZPL Format = "zpl"
+)
+
+// A Label holds the data printed on a product label.
+// Empty fields are not printed.
+type Label struct {
+	// Name is the name of the product
+	Name string
+	// Reference is the internal reference of the product
+	Reference string
+	// Attributes is the list of the variant attribute values of the product
+	Attributes string
+	// Price is the formatted price of the product, including its currency
+	Price string
+	// Barcode is the barcode of the product
+	Barcode string
+}
+
+// A Layout describes how labels are laid out on a sheet or on a thermal printer roll.
+// All dimensions are in millimeters.
+type Layout struct {
+	// Format is the output format of the labels
+	Format Format
+	// PageWidth is the width of the sheet or of the printer roll
+	PageWidth float64
+	// PageHeight is the height of the sheet. It is ignored for ZPL, for which
+	// a page is a single row of labels.
+	PageHeight float64
+	// Columns is the number of labels across the page
+	Columns int
+	// Rows is the number of labels down the page. It is ignored for ZPL.
+	Rows int
+	// LabelWidth is the width of a single label
+	LabelWidth float64
+	// LabelHeight is the height of a single label
+	LabelHeight float64
+	// MarginTop is the space between the top of the page and the first row of labels
+	MarginTop float64
+	// MarginLeft is the space between the left of the page and the first column of labels
+	MarginLeft float64
+	// HorizontalSpacing is the space between two columns of labels
+	HorizontalSpacing float64
+	// VerticalSpacing is the space between two rows of labels
+	VerticalSpacing float64
+	// Symbology is the barcode encoding to use
+	Symbology Symbology
+	// DPI is the resolution of the thermal printer in dots per inch. It is only used for ZPL.
+	DPI int
+}
+
+// layoutTolerance is the rounding tolerance in millimeters when checking that labels fit on a page
+const layoutTolerance = 0.01
+
+// Validate returns an error if this layout is inconsistent, for instance
+// if its labels do not fit on the page.
+func (l Layout) Validate() error {
+	if l.Format == FormatZPL {
+		l.Rows, l.VerticalSpacing, l.PageHeight = 1, 0, l.MarginTop+l.LabelHeight
+	}
+	if l.Columns < 1 || l.Rows < 1 {
+		return errors.New("there must be at least one column and one row of labels")
+	}
+	if l.LabelWidth <= 0 || l.LabelHeight <= 0 {
+		return errors.New("label width and height must be positive")
+	}
+	if l.MarginTop < 0 || l.MarginLeft < 0 || l.HorizontalSpacing < 0 || l.VerticalSpacing < 0 {
+		return errors.New("margins and spacings cannot be negative")
+	}
+	width := l.MarginLeft + float64(l.Columns)*l.LabelWidth + float64(l.Columns-1)*l.HorizontalSpacing
+	if width > l.PageWidth+layoutTolerance {
+		return fmt.Errorf("%d columns of labels need %.1f mm but the page is only %.1f mm wide", l.Columns, width, l.PageWidth)
+	}
+	height := l.MarginTop + float64(l.Rows)*l.LabelHeight + float64(l.Rows-1)*l.VerticalSpacing
+	if height > l.PageHeight+layoutTolerance {
+		return fmt.Errorf("%d rows of labels need %.1f mm but the page is only %.1f mm high", l.Rows, height, l.PageHeight)
+	}
+	return nil
+}
+
+// labelOrigin returns the position in mm of the top left corner of the label
+// at the given column and row, from the top left corner of the page.
+func (l Layout) labelOrigin(column, row int) (float64, float64) {
+	x := l.MarginLeft + float64(column)*(l.LabelWidth+l.HorizontalSpacing)
+	y := l.MarginTop + float64(row)*(l.LabelHeight+l.VerticalSpacing)
+	return x, y
+}
+
+// symbologyFor returns the symbology with which the given barcode is printed
+func (l Layout) symbologyFor(barcode string) Symbology {
+	if l.Symbology != SymbologyCode128 && isEAN13(barcode) {
+		return SymbologyEAN13
+	}
+	return SymbologyCode128
+}
+
+// Render returns the given labels rendered with the given layout, either as a
+// PDF document or as ZPL commands depending on the layout format.
+func Render(layout Layout, labels []Label) ([]byte, error) {
+	if layout.Format == FormatZPL {
+		return RenderZPL(layout, labels)
+	}
+	return RenderPDF(layout, labels)
+}
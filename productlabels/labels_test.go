@@ -0,0 +1,148 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package productlabels
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// modulesString returns the given modules as a 0/1 string
+func modulesString(modules []bool) string {
+	var res strings.Builder
+	for _, m := range modules {
+		if m {
+			res.WriteByte('1')
+		} else {
+			res.WriteByte('0')
+		}
+	}
+	return res.String()
+}
+
+func a4Layout() Layout {
+	return Layout{
+		PageWidth:   210,
+		PageHeight:  297,
+		Columns:     3,
+		Rows:        8,
+		LabelWidth:  63.5,
+		LabelHeight: 33.9,
+		MarginTop:   13.1,
+		MarginLeft:  7.2,
+		Symbology:   SymbologyAuto,
+	}
+}
+
+func TestBarcodes(t *testing.T) {
+	Convey("Testing barcode encodings", t, func() {
+		Convey("EAN-13", func() {
+			So(isEAN13("4006381333931"), ShouldBeTrue)
+			So(isEAN13("4006381333932"), ShouldBeFalse)
+			So(isEAN13("400638133393"), ShouldBeFalse)
+			modules := modulesString(ean13Modules("4006381333931"))
+			So(modules, ShouldHaveLength, 95)
+			So(modules[:3], ShouldEqual, "101")
+			So(modules[45:50], ShouldEqual, "01010")
+			So(modules[92:], ShouldEqual, "101")
+			// First digit 4 gives the GLLGGL parity: 0 in G-code then 0 in L-code
+			So(modules[3:17], ShouldEqual, "0100111"+"0001101")
+			// Right half digit 1 in R-code
+			So(modules[85:92], ShouldEqual, "1100110")
+		})
+		Convey("Code 128", func() {
+			for value, pattern := range code128Patterns {
+				sum := 0
+				for _, w := range pattern {
+					sum += int(w - '0')
+				}
+				if value == code128Stop {
+					So(sum, ShouldEqual, 13)
+				} else {
+					So(sum, ShouldEqual, 11)
+				}
+			}
+			So(code128Values("AB"), ShouldResemble, []int{code128StartB, 33, 34, (104 + 33 + 2*34) % 103})
+			So(code128Values("1234"), ShouldResemble, []int{code128StartC, 12, 34, (105 + 12 + 2*34) % 103})
+			So(code128Values("é"), ShouldResemble, []int{code128StartB, 31, (104 + 31) % 103})
+			modules := modulesString(code128Modules("AB"))
+			So(modules, ShouldHaveLength, 4*11+13)
+			So(modules[:11], ShouldEqual, "11010010000")
+			So(modules[len(modules)-13:], ShouldEqual, "1100011101011")
+		})
+	})
+}
+
+func TestLayouts(t *testing.T) {
+	Convey("Testing label layouts", t, func() {
+		layout := a4Layout()
+		So(layout.Validate(), ShouldBeNil)
+		x, y := layout.labelOrigin(2, 1)
+		So(x, ShouldAlmostEqual, 7.2+2*63.5)
+		So(y, ShouldAlmostEqual, 13.1+33.9)
+		So(layout.symbologyFor("4006381333931"), ShouldEqual, SymbologyEAN13)
+		So(layout.symbologyFor("ABC-123"), ShouldEqual, SymbologyCode128)
+		layout.Symbology = SymbologyCode128
+		So(layout.symbologyFor("4006381333931"), ShouldEqual, SymbologyCode128)
+		layout.Columns = 4
+		So(layout.Validate(), ShouldNotBeNil)
+		layout.Columns = 0
+		So(layout.Validate(), ShouldNotBeNil)
+	})
+}
+
+func TestRendering(t *testing.T) {
+	Convey("Testing label rendering", t, func() {
+		labels := make([]Label, 30)
+		for i := range labels {
+			labels[i] = Label{
+				Name:       "Customizable Desk (Steel, White)",
+				Reference:  "FURN_0096",
+				Attributes: "Steel, White",
+				Price:      "750.00 €",
+				Barcode:    "4006381333931",
+			}
+		}
+		labels[29].Barcode = "ABC>123"
+		Convey("PDF", func() {
+			pdf, err := RenderPDF(a4Layout(), labels)
+			So(err, ShouldBeNil)
+			So(bytes.HasPrefix(pdf, []byte("%PDF-1.4")), ShouldBeTrue)
+			So(bytes.HasSuffix(pdf, []byte("%%EOF\n")), ShouldBeTrue)
+			So(string(pdf), ShouldContainSubstring, "/Count 2")
+			So(string(pdf), ShouldContainSubstring, "(750.00 \x80)")
+			So(string(pdf), ShouldContainSubstring, "([FURN_0096] Steel, White)")
+			empty, err := RenderPDF(a4Layout(), nil)
+			So(err, ShouldBeNil)
+			So(string(empty), ShouldContainSubstring, "/Count 1")
+			layout := a4Layout()
+			layout.Rows = 9
+			_, err = RenderPDF(layout, labels)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("ZPL", func() {
+			layout := Layout{
+				PageWidth:   104,
+				Columns:     2,
+				LabelWidth:  50.8,
+				LabelHeight: 25.4,
+				Symbology:   SymbologyAuto,
+			}
+			labels[0].Name = "Desk ^ special_chars"
+			zpl, err := RenderZPL(layout, labels)
+			So(err, ShouldBeNil)
+			So(strings.Count(string(zpl), "^XA"), ShouldEqual, 15)
+			So(strings.Count(string(zpl), "^XZ"), ShouldEqual, 15)
+			So(string(zpl), ShouldContainSubstring, "^PW831")
+			So(string(zpl), ShouldContainSubstring, "^BEN,")
+			So(string(zpl), ShouldContainSubstring, "^FD400638133393^FS")
+			So(string(zpl), ShouldContainSubstring, "^BCN,")
+			So(string(zpl), ShouldContainSubstring, "^FDABC><123^FS")
+			So(string(zpl), ShouldContainSubstring, "^FDDesk _5E special_5Fchars^FS")
+		})
+	})
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package productlabels
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// pointsPerMM is the number of PDF points in a millimeter
+	pointsPerMM = 72 / 25.4
+	// labelPadding is the blank space in mm kept around the content of a label
+	labelPadding = 1.5
+	// maxModuleWidth is the maximum width in mm of a barcode module on PDF labels
+	maxModuleWidth = 0.5
+	// averageCharWidth is the approximate width of a Helvetica character, relative to the font size
+	averageCharWidth = 0.55
+)
+
+// PDF font resource names
+const (
+	pdfFontRegular = "F1"
+	pdfFontBold    = "F2"
+)
+
+// winAnsiSpecials maps the non Latin-1 characters of the WinAnsi encoding that
+// may appear on labels to their code.
+var winAnsiSpecials = map[rune]byte{
+	'€': 0x80,
+	'…': 0x85,
+	'‘': 0x91,
+	'’': 0x92,
+	'“': 0x93,
+	'”': 0x94,
+	'–': 0x96,
+	'—': 0x97,
+}
+
+// pdfString returns the given text as an escaped PDF literal string in WinAnsi encoding.
+// Characters that cannot be encoded are replaced by '?'.
+func pdfString(text string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r >= ' ' && r <= '~' || r >= 0xA0 && r <= 0xFF:
+			buf.WriteByte(byte(r))
+		case winAnsiSpecials[r] != 0:
+			buf.WriteByte(winAnsiSpecials[r])
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+// fitText returns the given text truncated so that it fits in the given width in
+// points when printed with the given font size.
+func fitText(text string, size, width float64) string {
+	runes := []rune(text)
+	maxChars := int(width / (size * averageCharWidth))
+	if len(runes) <= maxChars {
+		return text
+	}
+	if maxChars < 1 {
+		return ""
+	}
+	return string(runes[:maxChars-1]) + "…"
+}
+
+// A pdfPage builds the content stream of a PDF page.
+// Coordinates are given in mm from the top left corner of the page.
+type pdfPage struct {
+	content strings.Builder
+	height  float64
+}
+
+// text writes the given text with its baseline at the given position
+func (p *pdfPage) text(x, y float64, font string, size float64, text string) {
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td %s Tj ET\n",
+		font, size, x*pointsPerMM, (p.height-y)*pointsPerMM, pdfString(text))
+}
+
+// rect writes a filled rectangle whose top left corner is at the given position
+func (p *pdfPage) rect(x, y, width, height float64) {
+	fmt.Fprintf(&p.content, "%.3f %.3f %.3f %.3f re f\n",
+		x*pointsPerMM, (p.height-y-height)*pointsPerMM, width*pointsPerMM, height*pointsPerMM)
+}
+
+// barcode draws the given barcode modules centered in the given box, with the
+// human readable text below the bars.
+func (p *pdfPage) barcode(x, y, width, height float64, modules []bool, text string) {
+	moduleWidth := math.Min(width/float64(len(modules)+2*quietZoneModules), maxModuleWidth)
+	textSize := math.Min(7, height*pointsPerMM/4)
+	barsHeight := height - textSize/pointsPerMM
+	left := x + (width-moduleWidth*float64(len(modules)))/2
+	for i := 0; i < len(modules); i++ {
+		if !modules[i] {
+			continue
+		}
+		start := i
+		for i+1 < len(modules) && modules[i+1] {
+			i++
+		}
+		p.rect(left+float64(start)*moduleWidth, y, float64(i-start+1)*moduleWidth, barsHeight)
+	}
+	textWidth := float64(len([]rune(text))) * textSize * averageCharWidth / pointsPerMM
+	p.text(x+(width-textWidth)/2, y+height, pdfFontRegular, textSize, text)
+}
+
+// drawLabel draws the given label in the box whose top left corner is at the given position
+func (p *pdfPage) drawLabel(layout Layout, x, y float64, label Label) {
+	x += labelPadding
+	y += labelPadding
+	width := layout.LabelWidth - 2*labelPadding
+	bottom := y + layout.LabelHeight - 2*labelPadding
+	size := math.Min(10, layout.LabelHeight*pointsPerMM/8)
+	line := func(font string, fontSize float64, text string) {
+		if text == "" {
+			return
+		}
+		y += fontSize / pointsPerMM
+		p.text(x, y, font, fontSize, fitText(text, fontSize, width*pointsPerMM))
+		y += fontSize * 0.25 / pointsPerMM
+	}
+	line(pdfFontBold, size, label.Name)
+	info := label.Attributes
+	if label.Reference != "" {
+		info = strings.TrimSpace(fmt.Sprintf("[%s] %s", label.Reference, label.Attributes))
+	}
+	line(pdfFontRegular, size*0.8, info)
+	line(pdfFontBold, size*1.2, label.Price)
+	if label.Barcode == "" || bottom-y < 4 {
+		return
+	}
+	symbology := layout.symbologyFor(label.Barcode)
+	p.barcode(x, y+1, width, bottom-y-1, barcodeModules(label.Barcode, symbology), label.Barcode)
+}
+
+// RenderPDF returns a PDF document with the given labels laid out on pages
+// according to the given layout.
+func RenderPDF(layout Layout, labels []Label) ([]byte, error) {
+	layout.Format = FormatPDF
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	perPage := layout.Columns * layout.Rows
+	var pages []string
+	for start := 0; start < len(labels) || start == 0; start += perPage {
+		page := pdfPage{height: layout.PageHeight}
+		page.content.WriteString("0 g\n")
+		for i := start; i < start+perPage && i < len(labels); i++ {
+			x, y := layout.labelOrigin((i-start)%layout.Columns, (i-start)/layout.Columns)
+			page.drawLabel(layout, x, y, labels[i])
+		}
+		pages = append(pages, page.content.String())
+	}
+	return writePDF(layout.PageWidth*pointsPerMM, layout.PageHeight*pointsPerMM, pages), nil
+}
+
+// writePDF returns a PDF document with one page of the given size in points for
+// each of the given content streams.
+func writePDF(width, height float64, pages []string) []byte {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+	writeObject := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range pages {
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			width, height, pdfFontRegular, pdfFontBold, 6+2*i))
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package productlabels
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// defaultDPI is the printer resolution used when the layout does not define one
+const defaultDPI = 203
+
+// maxModuleDots is the maximum width in dots of a barcode module on ZPL labels
+const maxModuleDots = 4
+
+// zplEscaper escapes the ZPL control characters of field data, which must be
+// preceded by a ^FH_ command.
+var zplEscaper = strings.NewReplacer("_", "_5F", "^", "_5E", "~", "_7E")
+
+// A zplRow builds the ZPL commands of a row of labels
+type zplRow struct {
+	content strings.Builder
+	dpi     int
+}
+
+// dots returns the given length in mm as a number of printer dots
+func (z *zplRow) dots(mm float64) int {
+	return int(math.Round(mm * float64(z.dpi) / 25.4))
+}
+
+// text writes the given text in a single line block of the given width,
+// with its top left corner at the given position.
+func (z *zplRow) text(x, y, width, size float64, text string) {
+	fmt.Fprintf(&z.content, "^FO%d,%d^A0N,%d,%d^FB%d,1,0,L,0^FH_^FD%s^FS\n",
+		z.dots(x), z.dots(y), z.dots(size), z.dots(size), z.dots(width), zplEscaper.Replace(text))
+}
+
+// barcode writes the given barcode centered in the given box, with the
+// human readable text below the bars.
+func (z *zplRow) barcode(x, y, width, height float64, barcode string, symbology Symbology) {
+	modules := len(barcodeModules(barcode, symbology))
+	moduleDots := z.dots(width) / (modules + 2*quietZoneModules)
+	if moduleDots < 1 {
+		moduleDots = 1
+	}
+	if moduleDots > maxModuleDots {
+		moduleDots = maxModuleDots
+	}
+	left := z.dots(x) + (z.dots(width)-moduleDots*modules)/2
+	barsHeight := z.dots(height) - 3*z.dots(height)/10
+	switch symbology {
+	case SymbologyEAN13:
+		// The printer computes the check digit itself
+		fmt.Fprintf(&z.content, "^FO%d,%d^BY%d^BEN,%d,Y,N^FD%s^FS\n",
+			left, z.dots(y), moduleDots, barsHeight, barcode[:12])
+	default:
+		// '>' starts a subset invocation code in Code 128 field data
+		fmt.Fprintf(&z.content, "^FO%d,%d^BY%d^BCN,%d,Y,N,N^FD%s^FS\n",
+			left, z.dots(y), moduleDots, barsHeight, strings.Replace(barcode, ">", "><", -1))
+	}
+}
+
+// drawLabel writes the given label at the given position in mm from the top left
+// corner of the row.
+func (z *zplRow) drawLabel(layout Layout, x float64, label Label) {
+	x += labelPadding
+	y := labelPadding
+	width := layout.LabelWidth - 2*labelPadding
+	bottom := layout.LabelHeight - labelPadding
+	size := math.Min(3.5, layout.LabelHeight/8)
+	line := func(fontSize float64, text string) {
+		if text == "" {
+			return
+		}
+		z.text(x, y, width, fontSize, text)
+		y += fontSize * 1.25
+	}
+	line(size, label.Name)
+	info := label.Attributes
+	if label.Reference != "" {
+		info = strings.TrimSpace(fmt.Sprintf("[%s] %s", label.Reference, label.Attributes))
+	}
+	line(size*0.8, info)
+	line(size*1.2, label.Price)
+	if label.Barcode == "" || bottom-y < 4 {
+		return
+	}
+	z.barcode(x, y+1, width, bottom-y-1, label.Barcode, layout.symbologyFor(label.Barcode))
+}
+
+// RenderZPL returns the ZPL commands printing the given labels on a thermal
+// printer according to the given layout. Each label format holds a row of
+// layout.Columns labels. The page height and the number of rows of the layout
+// are ignored.
+func RenderZPL(layout Layout, labels []Label) ([]byte, error) {
+	layout.Format = FormatZPL
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	dpi := layout.DPI
+	if dpi <= 0 {
+		dpi = defaultDPI
+	}
+	var res strings.Builder
+	for start := 0; start < len(labels); start += layout.Columns {
+		row := zplRow{dpi: dpi}
+		fmt.Fprintf(&row.content, "^XA\n^CI28\n^PW%d\n^LL%d\n^LH0,%d\n",
+			row.dots(layout.PageWidth), row.dots(layout.LabelHeight), row.dots(layout.MarginTop))
+		for i := start; i < start+layout.Columns && i < len(labels); i++ {
+			x, _ := layout.labelOrigin(i-start, 0)
+			row.drawLabel(layout, x, labels[i])
+		}
+		row.content.WriteString("^XZ\n")
+		res.WriteString(row.content.String())
+	}
+	return []byte(res.String()), nil
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package producttypes
+
+// A PackagingSplit is a number of packages of a given packaging level,
+// as suggested by ProductProduct's SuggestPackagings method.
+type PackagingSplit struct {
+	// PackagingID is the ID of the ProductPackaging to use.
+	// It is 0 for the units that do not fit in any packaging.
+	PackagingID int64
+	// Count is the number of packages of this level.
+	// It is 0 for the units that do not fit in any packaging.
+	Count float64
+	// Quantity is the quantity of product in these packages,
+	// expressed in the product's unit of measure.
+	Quantity float64
+}
+
+// A BarcodeMatchType tells which kind of record a scanned barcode matched
+type BarcodeMatchType string
+
+// Barcode match types returned by ProductProduct's LookupBarcode method
+const (
+	// BarcodeNoMatch is returned when the barcode did not match anything
+	BarcodeNoMatch BarcodeMatchType = ""
+	// BarcodeProduct is a product variant barcode
+	BarcodeProduct BarcodeMatchType = "product"
+	// BarcodePackaging is a packaging barcode
+	BarcodePackaging BarcodeMatchType = "packaging"
+	// BarcodeWeight is a GS1 barcode with an embedded weight
+	BarcodeWeight BarcodeMatchType = "weight"
+	// BarcodePrice is a GS1 barcode with an embedded price
+	BarcodePrice BarcodeMatchType = "price"
+	// BarcodeVendorCode is a vendor product code
+	BarcodeVendorCode BarcodeMatchType = "vendor_code"
+)
+
+// A BarcodeLookup is the result of a barcode lookup
+type BarcodeLookup struct {
+	// Barcode is the scanned barcode
+	Barcode string
+	// Type tells what the barcode matched
+	Type BarcodeMatchType
+	// ProductID is the ID of the matched ProductProduct, if it could be determined
+	ProductID int64
+	// TemplateID is the ID of the matched ProductTemplate
+	TemplateID int64
+	// PackagingID is the ID of the matched ProductPackaging for BarcodePackaging matches
+	PackagingID int64
+	// SupplierinfoID is the ID of the matched ProductSupplierinfo for BarcodeVendorCode matches
+	SupplierinfoID int64
+	// Quantity is the quantity of product designated by the barcode in the product's UoM
+	Quantity float64
+	// Weight is the weight in kg embedded in the barcode for BarcodeWeight matches
+	Weight float64
+	// Price is the price embedded in the barcode for BarcodePrice matches
+	Price float64
+}
+
+// A BarcodeProblem tells what is wrong with a barcode
+type BarcodeProblem string
+
+// Barcode problems reported by ProductProduct's ValidateAllBarcodes method
+const (
+	// BarcodeInvalid is a barcode that does not match any rule of the barcode nomenclature
+	BarcodeInvalid BarcodeProblem = "invalid"
+	// BarcodeDuplicate is a barcode that is used by another active product or packaging of the same company
+	BarcodeDuplicate BarcodeProblem = "duplicate"
+)
+
+// A BarcodeIssue is a product or packaging barcode that is invalid or duplicated
+type BarcodeIssue struct {
+	// Model is the name of the model of the record holding the barcode,
+	// i.e. ProductProduct or ProductPackaging
+	Model string
+	// RecordID is the ID of the record holding the barcode
+	RecordID int64
+	// Name is the display name of the record holding the barcode
+	Name string
+	// Barcode is the faulty barcode
+	Barcode string
+	// Problem tells what is wrong with the barcode
+	Problem BarcodeProblem
+}
+
+// A ProductConfiguration describes the configurable attributes of a product template,
+// as returned by ProductTemplate's GetConfiguration method.
+type ProductConfiguration struct {
+	// TemplateID is the ID of the ProductTemplate
+	TemplateID int64 `json:"template_id"`
+	// Name is the name of the template
+	Name string `json:"name"`
+	// ListPrice is the sale price of the template, without price extras
+	ListPrice float64 `json:"list_price"`
+	// Currency is the symbol of the currency of the prices
+	Currency string `json:"currency"`
+	// Attributes are the attributes of the template in display order
+	Attributes []ConfigurableAttribute `json:"attributes"`
+	// Exclusions maps a value ID to the IDs of the values it cannot be combined with
+	Exclusions map[int64][]int64 `json:"exclusions"`
+}
+
+// A ConfigurableAttribute is an attribute of a ProductConfiguration
+type ConfigurableAttribute struct {
+	// ID is the ID of the ProductAttribute
+	ID int64 `json:"id"`
+	// Name is the name of the attribute
+	Name string `json:"name"`
+	// DisplayType tells how the attribute is presented: radio, select, color or pills
+	DisplayType string `json:"display_type"`
+	// CreateVariantMode is the variant creation mode of the attribute: always, dynamic or never
+	CreateVariantMode string `json:"create_variant_mode"`
+	// CustomType is the type of the custom value of the attribute, or an empty string
+	// if the value is chosen among Values.
+	CustomType string `json:"custom_type,omitempty"`
+	// CustomMin is the minimum custom value, or the minimum number of characters
+	// other than spaces for texts
+	CustomMin float64 `json:"custom_min,omitempty"`
+	// CustomMax is the maximum custom value, or the maximum number of characters
+	// other than spaces for texts. It is 0 if there is no maximum.
+	CustomMax float64 `json:"custom_max,omitempty"`
+	// CustomPriceExtra is the price extra of each unit of the custom value
+	CustomPriceExtra float64 `json:"custom_price_extra,omitempty"`
+	// Values are the values of the attribute available for the template
+	Values []ConfigurableValue `json:"values"`
+}
+
+// A ConfigurableValue is an attribute value of a ConfigurableAttribute
+type ConfigurableValue struct {
+	// ID is the ID of the ProductAttributeValue
+	ID int64 `json:"id"`
+	// Name is the name of the value
+	Name string `json:"name"`
+	// HTMLColor is the color of the value swatch, e.g. #FF0000
+	HTMLColor string `json:"html_color,omitempty"`
+	// ImageURL is the URL of the image of the value swatch, if any
+	ImageURL string `json:"image_url,omitempty"`
+	// PriceExtra is the price extra of the value for the template
+	PriceExtra float64 `json:"price_extra"`
+}
+
+// A VariantConfiguration is the variant matching a selection of attribute values,
+// as returned by ProductTemplate's ConfigureVariant method.
+type VariantConfiguration struct {
+	// TemplateID is the ID of the ProductTemplate
+	TemplateID int64 `json:"template_id"`
+	// ValueIDs are the IDs of the selected ProductAttributeValue records
+	ValueIDs []int64 `json:"value_ids"`
+	// Valid is true if the selected values define a variant of the template
+	Valid bool `json:"valid"`
+	// Errors explain why the selection is not valid
+	Errors []string `json:"errors,omitempty"`
+	// ProductID is the ID of the matching ProductProduct, even archived.
+	// It is 0 if the variant does not exist yet.
+	ProductID int64 `json:"product_id"`
+	// Available is true if the variant exists and is active, or if it is
+	// created on demand by a dynamic attribute.
+	Available bool `json:"available"`
+	// ListPrice is the sale price of the template, without price extras
+	ListPrice float64 `json:"list_price"`
+	// PriceExtra is the sum of the price extras of the selected values
+	PriceExtra float64 `json:"price_extra"`
+	// Price is the list price plus the price extras
+	Price float64 `json:"price"`
+	// Currency is the symbol of the currency of ListPrice, PriceExtra and Price
+	Currency string `json:"currency"`
+	// HasPricelistPrice is true if PricelistPrice has been computed. It is false
+	// when no pricelist is given or when the template has no variant at all.
+	HasPricelistPrice bool `json:"has_pricelist_price"`
+	// PricelistPrice is the price of the variant according to the given pricelist
+	PricelistPrice float64 `json:"pricelist_price"`
+	// PricelistCurrency is the symbol of the currency of PricelistPrice
+	PricelistCurrency string `json:"pricelist_currency,omitempty"`
+}
+
+// Types of price extras of ProductAttributePrice records
+const (
+	// PriceExtraFixed is a price extra given as an amount
+	PriceExtraFixed = "fixed"
+	// PriceExtraPercentage is a price extra given as a percentage of the sale price of the template
+	PriceExtraPercentage = "percentage"
+)
+
+// An AttributePriceExtra is the price extra of an attribute value for a product template,
+// as read and written by ProductTemplate's GetPriceExtraMatrix and SetPriceExtraMatrix methods.
+type AttributePriceExtra struct {
+	// TemplateID is the ID of the ProductTemplate
+	TemplateID int64 `json:"template_id"`
+	// ValueID is the ID of the ProductAttributeValue
+	ValueID int64 `json:"value_id"`
+	// PriceType is either PriceExtraFixed or PriceExtraPercentage.
+	// It defaults to PriceExtraFixed when empty.
+	PriceType string `json:"price_type"`
+	// PriceExtra is the amount of the price extra, or its percentage of the sale price of the template
+	PriceExtra float64 `json:"price_extra"`
+	// Amount is the resulting amount added to the sale price. It is ignored when writing.
+	Amount float64 `json:"amount"`
+}
+
+// DuplicateVariants are active variants of a template with the same attribute values
+type DuplicateVariants struct {
+	// TemplateID is the ID of the ProductTemplate
+	TemplateID int64 `json:"template_id"`
+	// ProductIDs are the IDs of the duplicate ProductProduct records, oldest first
+	ProductIDs []int64 `json:"product_ids"`
+}
+
+// A ValueMergeReport is the result of the replacement of attribute values by another value,
+// as returned by ProductAttributeValue's ReplaceWith and Rename methods.
+type ValueMergeReport struct {
+	// ValueIDs are the IDs of the replaced ProductAttributeValue records, which no longer exist
+	ValueIDs []int64 `json:"value_ids"`
+	// TargetID is the ID of the ProductAttributeValue replacing them
+	TargetID int64 `json:"target_id"`
+	// TemplateIDs are the IDs of the ProductTemplate records that used the replaced values
+	TemplateIDs []int64 `json:"template_ids"`
+	// Duplicates are the variants of these templates that now have the same attribute values
+	// and should be merged
+	Duplicates []DuplicateVariants `json:"duplicates"`
+}
+
+// A ValueRange summarizes a numeric value over the variants of a template
+type ValueRange struct {
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Average float64 `json:"average"`
+}
+
+// A VariantMatrixRow holds the values of a variant edited from its template,
+// as read and written by ProductTemplate's GetVariantMatrix and SetVariantMatrix methods.
+type VariantMatrixRow struct {
+	// ProductID is the ID of the ProductProduct
+	ProductID int64 `json:"product_id"`
+	// Name is the list of the attribute values of the variant. It is ignored when writing.
+	Name string `json:"name"`
+	// Weight is the weight of the variant in the weight UoM of the company
+	Weight float64 `json:"weight"`
+	// Volume is the volume of the variant in the volume UoM of the company
+	Volume float64 `json:"volume"`
+	// StandardPrice is the cost of the variant
+	StandardPrice float64 `json:"standard_price"`
+	// Barcode is the barcode of the variant
+	Barcode string `json:"barcode"`
+	// DefaultCode is the internal reference of the variant
+	DefaultCode string `json:"default_code"`
+}
+
+// A VariantMatrix holds the values of the active variants of a template,
+// as returned by ProductTemplate's GetVariantMatrix method.
+type VariantMatrix struct {
+	// TemplateID is the ID of the ProductTemplate
+	TemplateID int64 `json:"template_id"`
+	// WeightUom is the name of the UoM of the weights
+	WeightUom string `json:"weight_uom"`
+	// VolumeUom is the name of the UoM of the volumes
+	VolumeUom string `json:"volume_uom"`
+	// Rows are the values of each variant
+	Rows []VariantMatrixRow `json:"rows"`
+	// Weight summarizes the weights of the variants
+	Weight ValueRange `json:"weight"`
+	// Volume summarizes the volumes of the variants
+	Volume ValueRange `json:"volume"`
+	// StandardPrice summarizes the costs of the variants
+	StandardPrice ValueRange `json:"standard_price"`
+}
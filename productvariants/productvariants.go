@@ -0,0 +1,245 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+// Package productvariants computes the combinations of attribute values of
+// product variants on value IDs, so that large variant matrices can be
+// generated and compared to existing variants without recordset operations.
+package productvariants
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Key identifies a combination of attribute values regardless of the order of its values
+type Key string
+
+// NewKey returns the key of the combination of the given value IDs
+func NewKey(ids []int64) Key {
+	sorted := make([]int64, len(ids))
+	copy(sorted, ids)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var res strings.Builder
+	for i, id := range sorted {
+		if i > 0 {
+			res.WriteByte(',')
+		}
+		res.WriteString(strconv.FormatInt(id, 10))
+	}
+	return Key(res.String())
+}
+
+// Exclusions maps a value ID to the IDs of the values it cannot be combined with.
+// Exclusions are symmetric.
+type Exclusions map[int64]map[int64]bool
+
+// Add marks the given value as incompatible with each of the excluded values
+func (e Exclusions) Add(value int64, excluded ...int64) {
+	for _, other := range excluded {
+		if e[value] == nil {
+			e[value] = make(map[int64]bool)
+		}
+		if e[other] == nil {
+			e[other] = make(map[int64]bool)
+		}
+		e[value][other] = true
+		e[other][value] = true
+	}
+}
+
+// Allows returns true if no pair of the given values is excluded
+func (e Exclusions) Allows(ids []int64) bool {
+	if len(e) == 0 {
+		return true
+	}
+	for i, id := range ids {
+		excluded := e[id]
+		if len(excluded) == 0 {
+			continue
+		}
+		for _, other := range ids[i+1:] {
+			if excluded[other] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// allowsWith returns true if the given value can be added to the given allowed values
+func (e Exclusions) allowsWith(ids []int64, id int64) bool {
+	excluded := e[id]
+	if len(excluded) == 0 {
+		return true
+	}
+	for _, other := range ids {
+		if excluded[other] {
+			return false
+		}
+	}
+	return true
+}
+
+// A LimitError is returned when a matrix has more combinations than allowed
+type LimitError struct {
+	// Count is the number of combinations of the matrix, or a lower bound
+	// of it if Exact is false.
+	Count int
+	// Exact is false if the enumeration stopped before counting all combinations
+	Exact bool
+	// Limit is the maximum number of combinations allowed
+	Limit int
+}
+
+// Error returns the error message of this LimitError
+func (e *LimitError) Error() string {
+	if e.Exact {
+		return fmt.Sprintf("%d variants exceed the limit of %d", e.Count, e.Limit)
+	}
+	return fmt.Sprintf("more than %d variants exceed the limit of %d", e.Count, e.Limit)
+}
+
+// Count returns the number of combinations of the given lines without exclusions,
+// saturated at the given limit + 1 if limit is positive.
+func Count(lines [][]int64, limit int) int {
+	count := 1
+	for _, line := range lines {
+		count *= len(line)
+		if count == 0 {
+			return 0
+		}
+		if limit > 0 && count > limit {
+			return limit + 1
+		}
+	}
+	return count
+}
+
+// Matrix returns all the allowed combinations made of one value of each of the given
+// lines. Lines without values are ignored, so that a matrix without lines has a single
+// empty combination. If limit is positive and the matrix has more than limit allowed
+// combinations, Matrix returns a *LimitError.
+func Matrix(lines [][]int64, exclusions Exclusions, limit int) ([][]int64, error) {
+	var nonEmpty [][]int64
+	for _, line := range lines {
+		if len(line) > 0 {
+			nonEmpty = append(nonEmpty, line)
+		}
+	}
+	if len(exclusions) == 0 && limit > 0 && Count(nonEmpty, limit) > limit {
+		if count := exactCount(nonEmpty); count > 0 {
+			return nil, &LimitError{Count: count, Exact: true, Limit: limit}
+		}
+		return nil, &LimitError{Count: limit + 1, Limit: limit}
+	}
+	var res [][]int64
+	current := make([]int64, len(nonEmpty))
+	var walk func(int) bool
+	walk = func(depth int) bool {
+		if depth == len(nonEmpty) {
+			if limit > 0 && len(res) == limit {
+				return false
+			}
+			res = append(res, append(make([]int64, 0, len(current)), current...))
+			return true
+		}
+		for _, id := range nonEmpty[depth] {
+			// Prune excluded partial combinations early
+			if !exclusions.allowsWith(current[:depth], id) {
+				continue
+			}
+			current[depth] = id
+			if !walk(depth + 1) {
+				return false
+			}
+		}
+		return true
+	}
+	if !walk(0) {
+		return nil, &LimitError{Count: limit + 1, Limit: limit}
+	}
+	return res, nil
+}
+
+// exactCount returns the number of combinations of the given non empty lines,
+// or -1 if it overflows.
+func exactCount(lines [][]int64) int {
+	count := 1
+	for _, line := range lines {
+		if count > int(^uint(0)>>1)/len(line) {
+			return -1
+		}
+		count *= len(line)
+	}
+	return count
+}
+
+// IsValid returns true if the given value IDs hold exactly one value of each non
+// empty line, no other value and no excluded pair.
+func IsValid(lines [][]int64, exclusions Exclusions, ids []int64) bool {
+	values := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		values[id] = true
+	}
+	var count int
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var found int
+		for _, id := range line {
+			if values[id] {
+				found++
+			}
+		}
+		if found != 1 {
+			return false
+		}
+		count++
+	}
+	return count == len(values) && exclusions.Allows(ids)
+}
+
+// A Diff tells how to update existing variants to match a matrix
+type Diff struct {
+	// Create holds the combinations of the matrix without variant
+	Create [][]int64
+	// Keep holds the IDs of the variants whose combination is in the matrix
+	Keep []int64
+	// Remove holds the IDs of the variants whose combination is not in the matrix
+	Remove []int64
+}
+
+// Compare returns the Diff between the given matrix and the given existing variants,
+// which map variant IDs to the IDs of their values. Variant IDs are processed in
+// increasing order.
+func Compare(matrix [][]int64, existing map[int64][]int64) Diff {
+	index := make(map[Key]bool, len(matrix))
+	for _, combination := range matrix {
+		index[NewKey(combination)] = true
+	}
+	variantIDs := make([]int64, 0, len(existing))
+	for id := range existing {
+		variantIDs = append(variantIDs, id)
+	}
+	sort.Slice(variantIDs, func(i, j int) bool { return variantIDs[i] < variantIDs[j] })
+	var res Diff
+	found := make(map[Key]bool, len(existing))
+	for _, id := range variantIDs {
+		key := NewKey(existing[id])
+		if !index[key] {
+			res.Remove = append(res.Remove, id)
+			continue
+		}
+		res.Keep = append(res.Keep, id)
+		found[key] = true
+	}
+	for _, combination := range matrix {
+		if !found[NewKey(combination)] {
+			res.Create = append(res.Create, combination)
+		}
+	}
+	return res
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package productvariants
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// benchLines returns a matrix of 3 lines of sizes 20, 20 and 10 (4000 combinations)
+func benchLines() [][]int64 {
+	var lines [][]int64
+	next := int64(1)
+	for _, size := range []int{20, 20, 10} {
+		var line []int64
+		for i := 0; i < size; i++ {
+			line = append(line, next)
+			next++
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// benchExisting returns variants for every other combination of the given matrix
+func benchExisting(matrix [][]int64) map[int64][]int64 {
+	existing := make(map[int64][]int64)
+	for i, combination := range matrix {
+		if i%2 == 0 {
+			// Store values in another order than the matrix
+			reversed := make([]int64, len(combination))
+			for j, id := range combination {
+				reversed[len(combination)-1-j] = id
+			}
+			existing[int64(i+1)] = reversed
+		}
+	}
+	return existing
+}
+
+// naiveCompare is the previous quadratic algorithm comparing each combination
+// of the matrix with each existing variant.
+func naiveCompare(matrix [][]int64, existing map[int64][]int64) Diff {
+	sameValues := func(a, b []int64) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for _, x := range a {
+			var found bool
+			for _, y := range b {
+				if x == y {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	}
+	var res Diff
+	for _, combination := range matrix {
+		var exists bool
+		for _, values := range existing {
+			if sameValues(combination, values) {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			res.Create = append(res.Create, combination)
+		}
+	}
+	for id, values := range existing {
+		var inMatrix bool
+		for _, combination := range matrix {
+			if sameValues(combination, values) {
+				inMatrix = true
+				break
+			}
+		}
+		if inMatrix {
+			res.Keep = append(res.Keep, id)
+		} else {
+			res.Remove = append(res.Remove, id)
+		}
+	}
+	return res
+}
+
+func TestMatrix(t *testing.T) {
+	Convey("Testing variant matrices", t, func() {
+		Convey("Keys do not depend on the order of values", func() {
+			So(NewKey([]int64{12, 3, 7}), ShouldEqual, Key("3,7,12"))
+			So(NewKey([]int64{3, 12, 7}), ShouldEqual, NewKey([]int64{7, 3, 12}))
+			So(NewKey(nil), ShouldEqual, Key(""))
+		})
+		Convey("Matrices are the cartesian product of lines", func() {
+			matrix, err := Matrix([][]int64{{1, 2}, {}, {3, 4, 5}}, nil, 0)
+			So(err, ShouldBeNil)
+			So(matrix, ShouldResemble, [][]int64{{1, 3}, {1, 4}, {1, 5}, {2, 3}, {2, 4}, {2, 5}})
+			matrix, err = Matrix(nil, nil, 10)
+			So(err, ShouldBeNil)
+			So(matrix, ShouldResemble, [][]int64{{}})
+		})
+		Convey("Excluded combinations are skipped", func() {
+			exclusions := make(Exclusions)
+			exclusions.Add(4, 1, 2)
+			exclusions.Add(5, 1)
+			So(exclusions.Allows([]int64{1, 3}), ShouldBeTrue)
+			So(exclusions.Allows([]int64{3, 4, 1}), ShouldBeFalse)
+			matrix, err := Matrix([][]int64{{1, 2}, {3, 4, 5}}, exclusions, 0)
+			So(err, ShouldBeNil)
+			So(matrix, ShouldResemble, [][]int64{{1, 3}, {2, 3}, {2, 5}})
+		})
+		Convey("Matrices are limited", func() {
+			_, err := Matrix(benchLines(), nil, 1000)
+			So(err, ShouldResemble, &LimitError{Count: 4000, Exact: true, Limit: 1000})
+			So(err.Error(), ShouldEqual, "4000 variants exceed the limit of 1000")
+			exclusions := make(Exclusions)
+			exclusions.Add(1, 21)
+			_, err = Matrix(benchLines(), exclusions, 1000)
+			So(err, ShouldResemble, &LimitError{Count: 1001, Limit: 1000})
+			matrix, err := Matrix(benchLines(), exclusions, 4000)
+			So(err, ShouldBeNil)
+			So(matrix, ShouldHaveLength, 4000-10)
+			So(Count(benchLines(), 0), ShouldEqual, 4000)
+			So(Count(benchLines(), 100), ShouldEqual, 101)
+		})
+		Convey("Combinations are validated against lines", func() {
+			lines := [][]int64{{1, 2}, {3, 4}, {}}
+			exclusions := make(Exclusions)
+			exclusions.Add(2, 4)
+			So(IsValid(lines, exclusions, []int64{3, 1}), ShouldBeTrue)
+			So(IsValid(lines, exclusions, []int64{1}), ShouldBeFalse)
+			So(IsValid(lines, exclusions, []int64{1, 2, 3}), ShouldBeFalse)
+			So(IsValid(lines, exclusions, []int64{1, 3, 9}), ShouldBeFalse)
+			So(IsValid(lines, exclusions, []int64{2, 4}), ShouldBeFalse)
+			So(IsValid(nil, nil, nil), ShouldBeTrue)
+		})
+		Convey("Existing variants are compared to the matrix", func() {
+			matrix, _ := Matrix([][]int64{{1, 2}, {3, 4}}, nil, 0)
+			diff := Compare(matrix, map[int64][]int64{
+				10: {3, 1},
+				11: {4, 2},
+				12: {1, 5},
+				13: {1},
+			})
+			So(diff.Create, ShouldResemble, [][]int64{{1, 4}, {2, 3}})
+			So(diff.Keep, ShouldResemble, []int64{10, 11})
+			So(diff.Remove, ShouldResemble, []int64{12, 13})
+		})
+		Convey("Hashed comparison gives the same result as the naive one", func() {
+			matrix, _ := Matrix(benchLines(), nil, 0)
+			existing := benchExisting(matrix)
+			existing[-1] = []int64{1, 2, 3}
+			diff := Compare(matrix, existing)
+			naive := naiveCompare(matrix, existing)
+			So(diff.Create, ShouldResemble, naive.Create)
+			So(diff.Keep, ShouldHaveLength, len(naive.Keep))
+			So(diff.Remove, ShouldResemble, []int64{-1})
+		})
+	})
+}
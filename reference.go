@@ -0,0 +1,317 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+)
+
+var fields_ProductCategoryReference = map[string]models.FieldDefinition{
+	"ReferenceSequence": fields.Many2One{String: "Reference Sequence", RelationModel: h.Sequence(),
+		Help: `Sequence generating the internal reference of the new products of this category and of its
+subcategories without sequence. The prefix and padding of the sequence define the format of the references.`},
+	"ReferenceWithAttributes": fields.Boolean{String: "Append Variant Attributes",
+		Help: `If set, all the variants of a product share a reference generated by the sequence,
+followed by the codes of their attribute values, e.g. DESK00042-WHITE.`},
+}
+
+var fields_ProductTemplateReference = map[string]models.FieldDefinition{
+	"TemplateCode": fields.Char{String: "Template Reference", NoCopy: true, Index: true,
+		Help: "Reference shared by the variants of this product, from which their internal reference is generated"},
+	"SkuPattern": fields.Char{String: "Variant Reference Pattern",
+		Constraint: h.ProductTemplate().Methods().CheckSkuPattern(),
+		Help: `Pattern of the internal reference of the variants, e.g. {tmpl_code}-{Color}-{Memory}.
+{tmpl_code} is replaced by the template reference and {Attribute} by the code of the value of this attribute.
+Attributes are given by their untranslated name.
+The references of the variants are regenerated each time the variants are updated.`},
+}
+
+// skuTemplateCode is the placeholder of the template reference in SKU patterns
+const skuTemplateCode = "tmpl_code"
+
+// skuPlaceholder matches the placeholders of SKU patterns
+var skuPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// renderSkuPattern returns the given SKU pattern with its placeholders replaced by the
+// values returned by the given function. Empty values are skipped together with
+// their separator, so that no doubled or dangling separator remains.
+func renderSkuPattern(pattern string, value func(string) string) string {
+	var res strings.Builder
+	var separator string
+	var started, pending bool
+	last := 0
+	for i, loc := range skuPlaceholder.FindAllStringSubmatchIndex(pattern, -1) {
+		literal := pattern[last:loc[0]]
+		last = loc[1]
+		switch {
+		case i == 0:
+			res.WriteString(literal)
+		case started && !pending:
+			// Keep the separator following the last value written
+			separator, pending = literal, true
+		}
+		val := value(strings.TrimSpace(pattern[loc[2]:loc[3]]))
+		if val == "" {
+			continue
+		}
+		res.WriteString(separator)
+		res.WriteString(val)
+		separator, started, pending = "", true, false
+	}
+	res.WriteString(pattern[last:])
+	return res.String()
+}
+
+// attributeValueCode returns the code of the given attribute value used in generated references,
+// i.e. its code if set or its untranslated name in upper case without spaces nor punctuation.
+func attributeValueCode(value m.ProductAttributeValueSet) string {
+	if value.Code() != "" {
+		return value.Code()
+	}
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, value.WithContext("lang", "").Name())
+}
+
+// defaultCodeExists returns true if the given internal reference is used by any product
+// other than the given one, even archived.
+func defaultCodeExists(env models.Environment, code string, product m.ProductProductSet) bool {
+	return h.ProductProduct().NewSet(env).WithContext("active_test", false).Search(
+		q.ProductProduct().DefaultCode().Equals(code).And().ID().NotEquals(product.ID())).SearchCount() > 0
+}
+
+//`GetReferenceCategory returns the first category with a reference sequence among this
+//		category and its parents, or an empty set if there is none.`,
+func product_category_GetReferenceCategory(rs m.ProductCategorySet) m.ProductCategorySet {
+	for current := rs; current.IsNotEmpty(); current = current.Parent() {
+		if current.ReferenceSequence().IsNotEmpty() {
+			return current
+		}
+	}
+	return h.ProductCategory().NewSet(rs.Env())
+}
+
+//`RenumberProducts regenerates the internal references of all the active products
+//		of these categories and their subcategories.`,
+func product_category_RenumberProducts(rs m.ProductCategorySet) {
+	h.ProductProduct().Search(rs.Env(), q.ProductProduct().Category().ChildOf(rs)).
+		OrderBy("ProductTmpl", "ID").RenumberDefaultCodes()
+}
+
+//`SkuPatternCode returns the internal reference of this product built from the SKU pattern
+//		of its template, or an empty string if its template has no SKU pattern.`,
+func product_product_SkuPatternCode(rs m.ProductProductSet) string {
+	rs.EnsureOne()
+	tmpl := rs.ProductTmpl()
+	if tmpl.SkuPattern() == "" {
+		return ""
+	}
+	return renderSkuPattern(tmpl.SkuPattern(), func(name string) string {
+		if name == skuTemplateCode {
+			return tmpl.TemplateCode()
+		}
+		// Attribute names are translated, so match them in the source language
+		for _, value := range rs.AttributeValues().WithContext("lang", "").Records() {
+			if strings.EqualFold(value.Attribute().Name(), name) {
+				return attributeValueCode(value)
+			}
+		}
+		return ""
+	})
+}
+
+//`NextDefaultCode returns a new unique internal reference for this product, generated from
+//		the SKU pattern of its template if any, or else from the reference sequence of its category.
+//		It returns an empty string if no reference can be generated.`,
+func product_product_NextDefaultCode(rs m.ProductProductSet) string {
+	rs.EnsureOne()
+	if rs.ProductTmpl().SkuPattern() != "" {
+		rs.ProductTmpl().EnsureTemplateCode()
+		base := rs.SkuPatternCode()
+		if base == "" {
+			return ""
+		}
+		code := base
+		for i := 2; defaultCodeExists(rs.Env(), code, rs); i++ {
+			code = fmt.Sprintf("%s-%d", base, i)
+		}
+		return code
+	}
+	categ := rs.Category().GetReferenceCategory()
+	if categ.IsEmpty() {
+		return ""
+	}
+	sequence := categ.ReferenceSequence()
+	var codes []string
+	if categ.ReferenceWithAttributes() {
+		for _, value := range rs.AttributeValues().Records() {
+			if code := attributeValueCode(value); code != "" {
+				codes = append(codes, code)
+			}
+		}
+	}
+	if len(codes) == 0 {
+		code := sequence.Next()
+		for defaultCodeExists(rs.Env(), code, rs) {
+			code = sequence.Next()
+		}
+		return code
+	}
+	tmpl := rs.ProductTmpl()
+	tmpl.EnsureTemplateCode()
+	base := fmt.Sprintf("%s-%s", tmpl.TemplateCode(), strings.Join(codes, "-"))
+	code := base
+	for i := 2; defaultCodeExists(rs.Env(), code, rs); i++ {
+		code = fmt.Sprintf("%s-%d", base, i)
+	}
+	return code
+}
+
+//`GenerateDefaultCode sets a generated internal reference on each product of this set
+//		that has none and whose category has a reference sequence.`,
+func product_product_GenerateDefaultCode(rs m.ProductProductSet) {
+	for _, product := range rs.Records() {
+		if product.DefaultCode() != "" {
+			continue
+		}
+		if code := product.NextDefaultCode(); code != "" {
+			product.SetDefaultCode(code)
+		}
+	}
+}
+
+//`RenumberDefaultCodes replaces the internal references of the products of this set by
+//		newly generated ones. Products whose category has no reference sequence are left untouched.`,
+func product_product_RenumberDefaultCodes(rs m.ProductProductSet) {
+	products := rs.Filtered(func(r m.ProductProductSet) bool {
+		return r.Category().GetReferenceCategory().IsNotEmpty()
+	})
+	if products.IsEmpty() {
+		return
+	}
+	products.SetDefaultCode("")
+	for _, product := range products.Records() {
+		product.ProductTmpl().WithContext("generated_template_code", true).SetTemplateCode("")
+	}
+	products.GenerateDefaultCode()
+}
+
+//`EnsureTemplateCode sets a template reference generated by the reference sequence of the
+//		category on the templates of this set that have none.`,
+func product_template_EnsureTemplateCode(rs m.ProductTemplateSet) {
+	for _, tmpl := range rs.Records() {
+		if tmpl.TemplateCode() != "" {
+			continue
+		}
+		categ := tmpl.Category().GetReferenceCategory()
+		if categ.IsEmpty() {
+			continue
+		}
+		// The variants are already being updated, so the code must not trigger CreateVariants
+		tmpl.WithContext("generated_template_code", true).SetTemplateCode(categ.ReferenceSequence().Next())
+	}
+}
+
+//`ApplySkuPattern gives the active variants without an internal reference of the templates
+//		of this set that have a SKU pattern the reference built from this pattern. References
+//		that are already set are kept (see RegenerateSkuCodes).`,
+func product_template_ApplySkuPattern(rs m.ProductTemplateSet) {
+	for _, tmpl := range rs.Records() {
+		if tmpl.SkuPattern() == "" {
+			continue
+		}
+		tmpl.WithContext("active_test", false).ProductVariants().Filtered(func(r m.ProductProductSet) bool {
+			return r.Active()
+		}).GenerateDefaultCode()
+	}
+}
+
+//`RegenerateSkuCodes replaces the internal references of the active variants of the templates
+//		of this set that have a SKU pattern by the references built from this pattern.`,
+func product_template_RegenerateSkuCodes(rs m.ProductTemplateSet) {
+	for _, tmpl := range rs.Records() {
+		if tmpl.SkuPattern() == "" {
+			continue
+		}
+		tmpl.EnsureTemplateCode()
+		variants := tmpl.WithContext("active_test", false).ProductVariants().Filtered(func(r m.ProductProductSet) bool {
+			return r.Active()
+		})
+		if variants.IsEmpty() {
+			continue
+		}
+		// Clear the references first so that variants can swap their references
+		variants.SetDefaultCode("")
+		for _, variant := range variants.Records() {
+			variant.SetDefaultCode(variant.NextDefaultCode())
+		}
+	}
+}
+
+//`CheckSkuPattern checks that the SKU pattern of the templates of this set is well formed.`,
+func product_template_CheckSkuPattern(rs m.ProductTemplateSet) {
+	for _, tmpl := range rs.Records() {
+		pattern := tmpl.SkuPattern()
+		for _, match := range skuPlaceholder.FindAllStringSubmatch(pattern, -1) {
+			if strings.TrimSpace(match[1]) == "" {
+				log.Panic(rs.T("Error: The variant reference pattern %s contains an empty placeholder.", pattern))
+			}
+		}
+		if strings.ContainsAny(skuPlaceholder.ReplaceAllString(pattern, ""), "{}") {
+			log.Panic(rs.T("Error: The variant reference pattern %s has unbalanced braces.", pattern))
+		}
+	}
+}
+
+//`CheckDefaultCode checks that the internal reference of the products of this set is not
+//		used by another active product of the same company, if this company requires unique
+//		internal references. Archived products are not checked.`,
+func product_product_CheckDefaultCode(rs m.ProductProductSet) {
+	for _, product := range rs.Records() {
+		if product.DefaultCode() == "" || !product.Active() {
+			continue
+		}
+		if !barcodeCompany(rs.Env(), product.Company()).UniqueDefaultCodes() {
+			continue
+		}
+		cond := q.ProductProduct().DefaultCode().Equals(product.DefaultCode()).And().ID().NotEquals(product.ID())
+		if product.Company().IsNotEmpty() {
+			cond = cond.AndCond(q.ProductProduct().Company().Equals(product.Company()).Or().Company().IsNull())
+		}
+		if h.ProductProduct().Search(rs.Env(), cond).SearchCount() > 0 {
+			log.Panic(rs.T("Error: The internal reference %s is already used by another product.", product.DefaultCode()))
+		}
+	}
+}
+
+func init() {
+	h.ProductCategory().AddFields(fields_ProductCategoryReference)
+	h.ProductCategory().NewMethod("GetReferenceCategory", product_category_GetReferenceCategory)
+	h.ProductCategory().NewMethod("RenumberProducts", product_category_RenumberProducts)
+
+	h.ProductTemplate().AddFields(fields_ProductTemplateReference)
+	h.ProductTemplate().NewMethod("EnsureTemplateCode", product_template_EnsureTemplateCode)
+	h.ProductTemplate().NewMethod("ApplySkuPattern", product_template_ApplySkuPattern)
+	h.ProductTemplate().NewMethod("RegenerateSkuCodes", product_template_RegenerateSkuCodes)
+	h.ProductTemplate().NewMethod("CheckSkuPattern", product_template_CheckSkuPattern)
+
+	h.ProductProduct().NewMethod("SkuPatternCode", product_product_SkuPatternCode)
+	h.ProductProduct().NewMethod("NextDefaultCode", product_product_NextDefaultCode)
+	h.ProductProduct().NewMethod("GenerateDefaultCode", product_product_GenerateDefaultCode)
+	h.ProductProduct().NewMethod("RenumberDefaultCodes", product_product_RenumberDefaultCodes)
+	h.ProductProduct().NewMethod("CheckDefaultCode", product_product_CheckDefaultCode)
+}
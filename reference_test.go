@@ -0,0 +1,193 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDefaultCodeGeneration(t *testing.T) {
+	Convey("Testing internal reference generation", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			uomUnit := h.ProductUom().NewSet(env).GetRecord("product_product_uom_unit")
+			sequence := h.Sequence().Create(env, h.Sequence().NewData().
+				SetName("Desks").
+				SetPrefix("DESK").
+				SetPadding(4))
+			desks := h.ProductCategory().Create(env, h.ProductCategory().NewData().
+				SetName("Desks").
+				SetReferenceSequence(sequence))
+			officeDesks := h.ProductCategory().Create(env, h.ProductCategory().NewData().
+				SetName("Office Desks").
+				SetParent(desks))
+			newProduct := func(name string, categ m.ProductCategorySet) m.ProductProductSet {
+				return h.ProductProduct().Create(env, h.ProductProduct().NewData().
+					SetName(name).
+					SetCategory(categ).
+					SetUom(uomUnit).
+					SetUomPo(uomUnit))
+			}
+			Convey("New products get a reference from their category sequence", func() {
+				desk1 := newProduct("Desk 1", desks)
+				desk2 := newProduct("Desk 2", officeDesks)
+				So(desk1.DefaultCode(), ShouldEqual, "DESK0001")
+				So(desk2.DefaultCode(), ShouldEqual, "DESK0002")
+				other := newProduct("Chair", h.ProductCategory().NewSet(env).GetRecord("product_product_category_all"))
+				So(other.DefaultCode(), ShouldBeEmpty)
+			})
+			Convey("Given references are kept and generated ones skip used references", func() {
+				tmpl := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Standing Desk").
+					SetCategory(desks).
+					SetDefaultCode("DESK0001"))
+				So(tmpl.ProductVariant().DefaultCode(), ShouldEqual, "DESK0001")
+				desk := newProduct("Desk", desks)
+				So(desk.DefaultCode(), ShouldEqual, "DESK0002")
+			})
+			Convey("References must be unique among active products unless the company allows duplicates", func() {
+				desk := newProduct("Desk", desks)
+				So(h.Company().NewSet(env).CompanyDefaultGet().UniqueDefaultCodes(), ShouldBeTrue)
+				So(func() {
+					h.ProductProduct().Create(env, h.ProductProduct().NewData().
+						SetName("Other Desk").
+						SetDefaultCode(desk.DefaultCode()))
+				}, ShouldPanic)
+				copied := desk.Copy(h.ProductProduct().NewData())
+				So(copied.DefaultCode(), ShouldNotBeEmpty)
+				So(copied.DefaultCode(), ShouldNotEqual, desk.DefaultCode())
+				desk.SetActive(false)
+				So(func() {
+					h.ProductProduct().Create(env, h.ProductProduct().NewData().
+						SetName("Other Desk").
+						SetDefaultCode(desk.DefaultCode()))
+				}, ShouldNotPanic)
+				h.Company().NewSet(env).CompanyDefaultGet().SetUniqueDefaultCodes(false)
+				So(func() {
+					h.ProductProduct().Create(env, h.ProductProduct().NewData().
+						SetName("Third Desk").
+						SetDefaultCode(copied.DefaultCode()))
+				}, ShouldNotPanic)
+			})
+			Convey("Variants share the template reference followed by their attribute values", func() {
+				desks.SetReferenceWithAttributes(true)
+				color := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().SetName("Color"))
+				black := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+					SetName("Black").
+					SetAttribute(color))
+				white := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+					SetName("Off White").
+					SetAttribute(color))
+				tmpl := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Desk").
+					SetCategory(desks).
+					CreateAttributeLines(h.ProductAttributeLine().NewData().
+						SetAttribute(color).
+						SetValues(black.Union(white))))
+				So(tmpl.TemplateCode(), ShouldEqual, "DESK0001")
+				codes := make(map[string]bool)
+				for _, variant := range tmpl.ProductVariants().Records() {
+					codes[variant.DefaultCode()] = true
+				}
+				So(codes, ShouldResemble, map[string]bool{"DESK0001-BLACK": true, "DESK0001-OFFWHITE": true})
+			})
+			Convey("Products can be renumbered in bulk", func() {
+				desk1 := newProduct("Desk 1", desks)
+				desk2 := newProduct("Desk 2", officeDesks)
+				desk1.SetDefaultCode("OLD-1")
+				desks.RenumberProducts()
+				So(desk1.DefaultCode(), ShouldEqual, "DESK0003")
+				So(desk2.DefaultCode(), ShouldEqual, "DESK0004")
+				So(h.ProductProduct().Search(env, q.ProductProduct().DefaultCode().Equals("OLD-1")).IsEmpty(), ShouldBeTrue)
+			})
+		}), ShouldBeNil)
+	})
+}
+
+func TestSkuPattern(t *testing.T) {
+	Convey("Testing variant references built from SKU patterns", t, func() {
+		Convey("Rendering patterns", func() {
+			values := map[string]string{"tmpl_code": "PHN", "Color": "BLK", "Memory": "32G"}
+			value := func(name string) string { return values[name] }
+			So(renderSkuPattern("{tmpl_code}-{Color}-{Memory}", value), ShouldEqual, "PHN-BLK-32G")
+			So(renderSkuPattern("{tmpl_code}-{Size}-{Memory}", value), ShouldEqual, "PHN-32G")
+			So(renderSkuPattern("{Size}/{Color}", value), ShouldEqual, "BLK")
+			So(renderSkuPattern("X{ Color }-{Size}.", value), ShouldEqual, "XBLK.")
+		})
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			color := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().SetName("Color"))
+			black := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("Black").
+				SetCode("BLK").
+				SetAttribute(color))
+			white := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("White").
+				SetAttribute(color))
+			memory := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().SetName("Memory"))
+			mem32 := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("32 GB").
+				SetCode("32G").
+				SetAttribute(memory))
+			mem64 := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("64 GB").
+				SetCode("64G").
+				SetAttribute(memory))
+			phone := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Phone").
+				SetTemplateCode("PHN").
+				SetSkuPattern("{tmpl_code}-{Color}-{Memory}").
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(color).
+					SetValues(black.Union(white))).
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(memory).
+					SetValues(mem32)))
+			codes := func() map[string]bool {
+				res := make(map[string]bool)
+				for _, variant := range phone.ProductVariants().Records() {
+					res[variant.DefaultCode()] = true
+				}
+				return res
+			}
+			Convey("Variants get their reference from the pattern", func() {
+				So(codes(), ShouldResemble, map[string]bool{"PHN-BLK-32G": true, "PHN-WHITE-32G": true})
+			})
+			Convey("New variants get a reference and existing references are kept", func() {
+				blackPhone := phone.FindVariant(black.Union(mem32))
+				blackPhone.SetDefaultCode("PHONE-1")
+				phone.AttributeLines().Filtered(func(r m.ProductAttributeLineSet) bool {
+					return r.Attribute().Equals(memory)
+				}).SetValues(mem32.Union(mem64))
+				phone.CreateVariants()
+				So(codes(), ShouldResemble, map[string]bool{
+					"PHONE-1": true, "PHN-WHITE-32G": true, "PHN-BLK-64G": true, "PHN-WHITE-64G": true})
+				white.SetCode("WHT")
+				phone.SetSkuPattern("{tmpl_code}{Memory}{Color}")
+				So(codes(), ShouldResemble, map[string]bool{
+					"PHONE-1": true, "PHN-WHITE-32G": true, "PHN-BLK-64G": true, "PHN-WHITE-64G": true})
+				Convey("References are regenerated on demand", func() {
+					phone.RegenerateSkuCodes()
+					So(codes(), ShouldResemble, map[string]bool{
+						"PHN32GBLK": true, "PHN32GWHT": true, "PHN64GBLK": true, "PHN64GWHT": true})
+				})
+			})
+			Convey("References do not depend on the language of the user", func() {
+				color.WithContext("lang", "fr_FR").SetName("Couleur")
+				for _, variant := range phone.ProductVariants().Records() {
+					So(variant.WithContext("lang", "fr_FR").SkuPatternCode(), ShouldEqual, variant.DefaultCode())
+				}
+			})
+			Convey("Malformed patterns are rejected", func() {
+				So(func() { phone.SetSkuPattern("{tmpl_code}-{Color") }, ShouldPanic)
+				So(func() { phone.SetSkuPattern("{tmpl_code}-{}") }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
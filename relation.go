@@ -0,0 +1,183 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"log"
+
+	"github.com/gleke/decimalPrecision"
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/hexya/src/models/operator"
+	"github.com/gleke/hexya/src/models/types"
+	"github.com/gleke/hexya/src/models/types/dates"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+)
+
+var fields_ProductRelation = map[string]models.FieldDefinition{
+	"ProductTmpl": fields.Many2One{String: "Product", RelationModel: h.ProductTemplate(),
+		OnDelete: models.Cascade, Required: true, Index: true,
+		Constraint: h.ProductRelation().Methods().CheckRelation()},
+	"Sequence": fields.Integer{Default: models.DefaultValue(10)},
+	"RelationType": fields.Selection{String: "Relation", Selection: types.Selection{
+		"alternative": "Alternative",
+		"accessory":   "Accessory",
+		"replacement": "Replaced By",
+		"spare_part":  "Spare Part",
+	}, Required: true, Default: models.DefaultValue("alternative"),
+		Constraint: h.ProductRelation().Methods().CheckRelation(),
+		Help: `Alternative: the related product can be sold instead of this product.
+Accessory: the related product can be sold with this product.
+Replaced By: the related product is the successor of this product.
+Spare Part: the related product is a spare part of this product.`},
+	"RelatedTmpl": fields.Many2One{String: "Related Product", RelationModel: h.ProductTemplate(),
+		OnDelete: models.Cascade, Required: true, Index: true,
+		Constraint: h.ProductRelation().Methods().CheckRelation()},
+	"Quantity": fields.Float{Digits: decimalPrecision.GetPrecision("Product Unit of Measure"),
+		Help: "Quantity of the related product for one unit of this product, e.g. the number of spare parts. Keep empty if not relevant."},
+	"Date": fields.Date{String: "Replacement Date",
+		Help: "Date from which the related product replaces this product. Keep empty if it replaces it already. Only used for replacements."},
+}
+
+var fields_ProductTemplateRelation = map[string]models.FieldDefinition{
+	"Relations": fields.One2Many{String: "Related Products", RelationModel: h.ProductRelation(),
+		ReverseFK: "ProductTmpl", JSON: "product_relation_ids", Copy: true},
+}
+
+//`CheckRelation checks that the relations of this set do not relate a product to itself,
+//		are not defined twice and do not make a product its own successor.`,
+func product_relation_CheckRelation(rs m.ProductRelationSet) {
+	for _, rel := range rs.Records() {
+		if rel.RelatedTmpl().Equals(rel.ProductTmpl()) {
+			log.Panic(rs.T("Error: The product %s cannot be related to itself.", rel.ProductTmpl().Name()))
+		}
+		if h.ProductRelation().Search(rs.Env(),
+			q.ProductRelation().ProductTmpl().Equals(rel.ProductTmpl()).
+				And().RelationType().Equals(rel.RelationType()).
+				And().RelatedTmpl().Equals(rel.RelatedTmpl())).SearchCount() > 1 {
+			log.Panic(rs.T("Error: The product %s is already related to %s.",
+				rel.RelatedTmpl().Name(), rel.ProductTmpl().Name()))
+		}
+		if rel.RelationType() == "replacement" && rel.RelatedTmpl().ReplacedBy(rel.ProductTmpl()) {
+			log.Panic(rs.T("Error: The product %s cannot be replaced by %s as it replaces it.",
+				rel.ProductTmpl().Name(), rel.RelatedTmpl().Name()))
+		}
+	}
+}
+
+//`GetRelatedProducts returns the products related to this template with the given relation type.`,
+func product_template_GetRelatedProducts(rs m.ProductTemplateSet, relationType string) m.ProductTemplateSet {
+	rs.EnsureOne()
+	res := h.ProductTemplate().NewSet(rs.Env())
+	for _, rel := range rs.Relations().Records() {
+		if rel.RelationType() == relationType {
+			res = res.Union(rel.RelatedTmpl())
+		}
+	}
+	return res
+}
+
+//`ReplacedBy returns true if the given template is a successor of this template, directly or
+//		through other successors, whatever the replacement dates.`,
+func product_template_ReplacedBy(rs m.ProductTemplateSet, tmpl m.ProductTemplateSet) bool {
+	visited := make(map[int64]bool)
+	var replacedBy func(product m.ProductTemplateSet) bool
+	replacedBy = func(product m.ProductTemplateSet) bool {
+		if visited[product.ID()] {
+			return false
+		}
+		visited[product.ID()] = true
+		for _, successor := range product.GetRelatedProducts("replacement").Records() {
+			if successor.Equals(tmpl) || replacedBy(successor) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, product := range rs.Records() {
+		if replacedBy(product) {
+			return true
+		}
+	}
+	return false
+}
+
+//`GetSuccessor returns the product that replaces this template at the given date, that is the
+//		replacement with the latest date before the given date. If date is the zero value, the
+//		latest replacement is returned whatever its date.`,
+func product_template_GetSuccessor(rs m.ProductTemplateSet, date dates.Date) m.ProductTemplateSet {
+	rs.EnsureOne()
+	res := h.ProductTemplate().NewSet(rs.Env())
+	var resDate dates.Date
+	for _, rel := range rs.Relations().Records() {
+		if rel.RelationType() != "replacement" {
+			continue
+		}
+		if !date.IsZero() && rel.Date().Greater(date) {
+			continue
+		}
+		if res.IsEmpty() || rel.Date().Greater(resDate) {
+			res = rel.RelatedTmpl()
+			resDate = rel.Date()
+		}
+	}
+	return res
+}
+
+// activeSuccessor returns the first active product in the successors of the given template
+// at the given date, or an empty set if there is none.
+func activeSuccessor(tmpl m.ProductTemplateSet, date dates.Date) m.ProductTemplateSet {
+	visited := make(map[int64]bool)
+	for tmpl.IsNotEmpty() && !visited[tmpl.ID()] {
+		visited[tmpl.ID()] = true
+		successor := tmpl.GetSuccessor(date)
+		if successor.IsEmpty() || successor.Active() {
+			return successor
+		}
+		tmpl = successor
+	}
+	return h.ProductTemplate().NewSet(tmpl.Env())
+}
+
+// archivedProductSuccessors returns the active variants of the successors of the archived products
+// matching the given name search, except the given products. At most limit variants are returned
+// if limit is positive.
+func archivedProductSuccessors(rs m.ProductProductSet, name string, op operator.Operator,
+	additionalCond q.ProductProductCondition, exclude m.ProductProductSet, limit int) m.ProductProductSet {
+
+	// SearchByName does not apply the additional condition to its searches on references and names
+	archived := rs.WithContext("active_test", false).WithContext("follow_successors", false).
+		SearchByName(name, op, q.ProductProduct().Active().Equals(false).AndCond(additionalCond), limit).
+		Filtered(func(r m.ProductProductSet) bool { return !r.Active() })
+	successors := h.ProductTemplate().NewSet(rs.Env())
+	for _, product := range archived.Records() {
+		successors = successors.Union(activeSuccessor(product.ProductTmpl(), dates.Today()))
+	}
+	if successors.IsEmpty() {
+		return h.ProductProduct().NewSet(rs.Env())
+	}
+	cond := q.ProductProduct().ProductTmpl().In(successors).AndCond(additionalCond)
+	if exclude.IsNotEmpty() {
+		cond = cond.And().ID().NotIn(exclude.Ids())
+	}
+	res := h.ProductProduct().Search(rs.Env(), cond)
+	if limit > 0 {
+		res = res.Limit(limit)
+	}
+	return res
+}
+
+func init() {
+	models.NewModel("ProductRelation")
+	h.ProductRelation().SetDefaultOrder("Sequence", "ID")
+	h.ProductRelation().AddFields(fields_ProductRelation)
+	h.ProductRelation().NewMethod("CheckRelation", product_relation_CheckRelation)
+
+	h.ProductTemplate().AddFields(fields_ProductTemplateRelation)
+	h.ProductTemplate().NewMethod("GetRelatedProducts", product_template_GetRelatedProducts)
+	h.ProductTemplate().NewMethod("ReplacedBy", product_template_ReplacedBy)
+	h.ProductTemplate().NewMethod("GetSuccessor", product_template_GetSuccessor)
+}
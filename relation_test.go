@@ -0,0 +1,90 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/operator"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/hexya/src/models/types/dates"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProductRelations(t *testing.T) {
+	Convey("Testing product relations", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			newTemplate := func(name string) m.ProductTemplateSet {
+				return h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName(name).
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit))
+			}
+			drillV1 := newTemplate("Zorglub Drill V1")
+			drillV2 := newTemplate("Zorglub Drill V2")
+			drillV3 := newTemplate("Zorglub Drill V3")
+			battery := newTemplate("Zorglub Battery")
+			h.ProductRelation().Create(env, h.ProductRelation().NewData().
+				SetProductTmpl(drillV2).
+				SetRelationType("accessory").
+				SetRelatedTmpl(battery).
+				SetQuantity(2))
+			h.ProductRelation().Create(env, h.ProductRelation().NewData().
+				SetProductTmpl(drillV1).
+				SetRelationType("replacement").
+				SetRelatedTmpl(drillV2))
+			h.ProductRelation().Create(env, h.ProductRelation().NewData().
+				SetProductTmpl(drillV2).
+				SetRelationType("replacement").
+				SetRelatedTmpl(drillV3).
+				SetDate(dates.ParseDate("2100-01-01")))
+			Convey("Related products are found by type", func() {
+				So(drillV2.GetRelatedProducts("accessory").Equals(battery), ShouldBeTrue)
+				So(drillV2.GetRelatedProducts("spare_part").IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Successors depend on the replacement date", func() {
+				So(drillV1.GetSuccessor(dates.Today()).Equals(drillV2), ShouldBeTrue)
+				So(drillV2.GetSuccessor(dates.Today()).IsEmpty(), ShouldBeTrue)
+				So(drillV2.GetSuccessor(dates.ParseDate("2100-02-01")).Equals(drillV3), ShouldBeTrue)
+			})
+			Convey("Products cannot replace their successors", func() {
+				So(func() {
+					h.ProductRelation().Create(env, h.ProductRelation().NewData().
+						SetProductTmpl(drillV3).
+						SetRelationType("replacement").
+						SetRelatedTmpl(drillV1))
+				}, ShouldPanic)
+				So(func() {
+					h.ProductRelation().Create(env, h.ProductRelation().NewData().
+						SetProductTmpl(battery).
+						SetRelationType("alternative").
+						SetRelatedTmpl(battery))
+				}, ShouldPanic)
+			})
+			Convey("Name search can follow successors of archived products", func() {
+				drillV1.SetActive(false)
+				res := h.ProductProduct().NewSet(env).SearchByName("Drill V1", operator.IContains, q.ProductProductCondition{}, 0)
+				So(res.IsEmpty(), ShouldBeTrue)
+				res = h.ProductProduct().NewSet(env).WithContext("follow_successors", true).
+					SearchByName("Drill V1", operator.IContains, q.ProductProductCondition{}, 0)
+				So(res.Equals(drillV2.ProductVariant()), ShouldBeTrue)
+				res = h.ProductProduct().NewSet(env).WithContext("follow_successors", true).
+					SearchByName("Zorglub", operator.IContains, q.ProductProductCondition{}, 1)
+				So(res.Len(), ShouldEqual, 1)
+			})
+			Convey("Active products are not followed to their successors", func() {
+				So(archivedProductSuccessors(h.ProductProduct().NewSet(env), "Zorglub Drill", operator.IContains,
+					q.ProductProductCondition{}, h.ProductProduct().NewSet(env), 0).IsEmpty(), ShouldBeTrue)
+				res := h.ProductProduct().NewSet(env).WithContext("follow_successors", true).
+					SearchByName("Drill V1", operator.IContains, q.ProductProductCondition{}, 0)
+				So(res.Equals(drillV1.ProductVariant()), ShouldBeTrue)
+			})
+		}), ShouldBeNil)
+	})
+}
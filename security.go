@@ -42,4 +42,13 @@ func init() {
 	h.ProductAttributeValue().Methods().Load().AllowGroup(base.GroupUser)
 	h.ProductAttributePrice().Methods().Load().AllowGroup(base.GroupUser)
 	h.ProductAttributeLine().Methods().Load().AllowGroup(base.GroupUser)
+	h.ProductAttributeExclusion().Methods().Load().AllowGroup(base.GroupUser)
+	h.ProductAttributeCustomValue().Methods().Load().AllowGroup(base.GroupUser)
+	h.ProductKitLine().Methods().Load().AllowGroup(base.GroupUser)
+	h.ProductRelation().Methods().Load().AllowGroup(base.GroupUser)
+	h.ProductLifecycleTransition().Methods().Load().AllowGroup(base.GroupUser)
+	h.ProductLifecycleLog().Methods().Load().AllowGroup(base.GroupUser)
+	h.BarcodeNomenclature().Methods().Load().AllowGroup(base.GroupUser)
+	h.BarcodeRule().Methods().Load().AllowGroup(base.GroupUser)
+	h.ProductLabelLayout().Methods().Load().AllowGroup(base.GroupUser)
 }
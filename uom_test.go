@@ -9,6 +9,7 @@ import (
 	"github.com/gleke/hexya/src/models"
 	"github.com/gleke/hexya/src/models/security"
 	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/q"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -46,6 +47,37 @@ func TestUom(t *testing.T) {
 				// Unlike Odoo, we do not want to go into rounding issues with epsilons.
 				So(qty, ShouldEqual, 0)
 			})
+			Convey("Weights and volumes in company units", func() {
+				company := h.User().NewSet(env).CurrentUser().Company()
+				company.SetWeightUom(h.ProductUom().NewSet(env).GetRecord("product_product_uom_lb"))
+				company.SetVolumeUom(h.ProductUom().NewSet(env).GetRecord("product_product_uom_litre"))
+				template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Crate").
+					SetWeight(22.0462).
+					SetVolume(50))
+				So(template.WeightUomName(), ShouldEqual, "lb")
+				So(template.ProductVariant().Weight(), ShouldAlmostEqual, 10, 0.0001)
+				So(template.ProductVariant().Volume(), ShouldAlmostEqual, 0.05, 0.0001)
+				So(template.Weight(), ShouldAlmostEqual, 22.0462, 0.0001)
+				So(template.Volume(), ShouldAlmostEqual, 50, 0.0001)
+				So(template.ReferenceWeight(), ShouldAlmostEqual, 10, 0.0001)
+				So(h.ProductTemplate().Search(env,
+					q.ProductTemplate().ReferenceWeight().Greater(9.9).
+						And().ReferenceWeight().Lower(10.1)).Intersect(template).Equals(template), ShouldBeTrue)
+			})
+			Convey("Volume from dimensions", func() {
+				uomCm := h.ProductUom().NewSet(env).GetRecord("product_product_uom_cm")
+				product := h.ProductProduct().Create(env, h.ProductProduct().NewData().
+					SetName("Carton").
+					SetDimensionalUom(uomCm).
+					SetLength(50).
+					SetWidth(40).
+					SetHeight(30))
+				So(product.Volume(), ShouldAlmostEqual, 0.06, 0.000001)
+				product.SetHeight(60)
+				So(product.Volume(), ShouldAlmostEqual, 0.12, 0.000001)
+				So(uomCm.ComputeVolume(10, 10, 0), ShouldEqual, 0)
+			})
 		}), ShouldBeNil)
 	})
 }
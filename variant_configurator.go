@@ -0,0 +1,138 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"github.com/gleke/hexya/src/models/types/dates"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
+)
+
+//`CheckCombination returns the reasons why the given attribute values cannot be
+//		selected together for this template, or nil if they can. Each value must belong to
+//		an attribute line of this template, at most one value can be chosen per attribute
+//		and a value is required for each attribute creating variants.`,
+func product_template_CheckCombination(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) []string {
+	rs.EnsureOne()
+	var errs []string
+	selected := make(map[int64]int)
+	for _, value := range values.Records() {
+		line := rs.AttributeLines().Filtered(func(r m.ProductAttributeLineSet) bool {
+			return r.Attribute().Equals(value.Attribute())
+		})
+		if line.IsEmpty() || line.Values().Intersect(value).IsEmpty() {
+			errs = append(errs, rs.T("The value %s is not available for this product.", value.NameGet()))
+			continue
+		}
+		selected[value.Attribute().ID()]++
+	}
+	for _, line := range rs.AttributeLines().Records() {
+		switch {
+		case selected[line.Attribute().ID()] > 1:
+			errs = append(errs, rs.T("Only one value can be chosen for the attribute %s.", line.Attribute().Name()))
+		case selected[line.Attribute().ID()] == 0 && line.Attribute().CreateVariant():
+			errs = append(errs, rs.T("A value must be chosen for the attribute %s.", line.Attribute().Name()))
+		}
+	}
+	if len(errs) == 0 && !rs.VariantExclusions().Allows(values.Ids()) {
+		errs = append(errs, rs.T("This combination of values is not available."))
+	}
+	return errs
+}
+
+//`FindVariant returns the variant of this template, even archived, with the given attribute
+//		values, or an empty set if it does not exist. Values of attributes that never create
+//		variants are ignored.`,
+func product_template_FindVariant(rs m.ProductTemplateSet, values m.ProductAttributeValueSet) m.ProductProductSet {
+	rs.EnsureOne()
+	values = rs.VariantValues(values)
+	for _, variant := range rs.WithContext("active_test", false).ProductVariants().Records() {
+		if rs.VariantValues(variant.AttributeValues()).Equals(values) {
+			return variant
+		}
+	}
+	return h.ProductProduct().NewSet(rs.Env())
+}
+
+//`ConfigureVariant checks the given attribute values against the attribute lines of this
+//		template and returns the matching variant, or the variant that would be created for
+//		these values, with its prices. The price extras include the values of attributes that
+//		never create variants. If the pricelist is not empty, the price is also computed with
+//		this pricelist for the given quantity and partner.`,
+func product_template_ConfigureVariant(rs m.ProductTemplateSet, values m.ProductAttributeValueSet,
+	pricelist m.ProductPricelistSet, quantity float64, partner m.PartnerSet) producttypes.VariantConfiguration {
+
+	rs.EnsureOne()
+	res := producttypes.VariantConfiguration{
+		TemplateID: rs.ID(),
+		ValueIDs:   values.Ids(),
+		Errors:     rs.CheckCombination(values),
+		ListPrice:  rs.ListPrice(),
+		PriceExtra: rs.GetCombinationPriceExtra(values),
+		Currency:   rs.Currency().Symbol(),
+	}
+	res.Valid = len(res.Errors) == 0
+	res.Price = res.ListPrice + res.PriceExtra
+	if !res.Valid {
+		return res
+	}
+	variant := rs.FindVariant(values)
+	res.ProductID = variant.ID()
+	if variant.IsNotEmpty() && variant.UseFixedSalePrice() {
+		// Extras of attributes that never create variants still apply to fixed sale prices
+		res.Price = variant.FixedSalePrice() + res.PriceExtra - variant.PriceExtra()
+	}
+	res.Available = (variant.IsNotEmpty() && variant.Active()) || rs.HasDynamicAttributes()
+	if pricelist.IsEmpty() {
+		return res
+	}
+	res.PricelistPrice, res.HasPricelistPrice = rs.GetCombinationPricelistPrice(values, pricelist, quantity, partner)
+	if res.HasPricelistPrice {
+		res.PricelistCurrency = pricelist.Currency().Symbol()
+	}
+	return res
+}
+
+//`GetCombinationPricelistPrice returns the price of the given attribute values of this template
+//		given by the pricelist for the given quantity and partner, and whether it could be computed.
+//		The price extras include the values of attributes that never create variants. A combination
+//		without variant is priced through another variant of this template, ignoring the rules
+//		specific to that variant, and cannot be priced if this template has no variant at all.`,
+func product_template_GetCombinationPricelistPrice(rs m.ProductTemplateSet, values m.ProductAttributeValueSet,
+	pricelist m.ProductPricelistSet, quantity float64, partner m.PartnerSet) (float64, bool) {
+
+	rs.EnsureOne()
+	extra := rs.GetCombinationPriceExtra(values)
+	listPrice := rs.ListPrice()
+	if rs.IsKit() && rs.KitListPrice() {
+		listPrice = rs.GetKitPrice(q.ProductProduct().ListPrice())
+	}
+	combination := combinationPrice{listPrice: listPrice + extra}
+	product := rs.FindVariant(values)
+	switch {
+	case product.IsEmpty():
+		product = rs.WithContext("active_test", false).ProductVariants().Limit(1)
+		if product.IsEmpty() {
+			return 0, false
+		}
+		combination.proxy = true
+	case product.UseFixedSalePrice():
+		// Extras of attributes that never create variants still apply to fixed sale prices
+		combination.listPrice = product.FixedSalePrice() + extra - product.PriceExtra()
+	}
+	if quantity == 0 {
+		quantity = 1
+	}
+	price, _ := computePriceRule(pricelist, product, quantity, partner, dates.Today(), rs.Uom(), &combination)
+	return price, true
+}
+
+func init() {
+	h.ProductTemplate().NewMethod("CheckCombination", product_template_CheckCombination)
+	h.ProductTemplate().NewMethod("FindVariant", product_template_FindVariant)
+	h.ProductTemplate().NewMethod("ConfigureVariant", product_template_ConfigureVariant)
+	h.ProductTemplate().NewMethod("GetCombinationPricelistPrice", product_template_GetCombinationPricelistPrice)
+}
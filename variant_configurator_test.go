@@ -0,0 +1,142 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVariantConfigurator(t *testing.T) {
+	Convey("Testing the variant configurator", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			size := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+				SetName("Size").
+				SetCreateVariantMode("dynamic"))
+			sizeS := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("S").
+				SetAttribute(size))
+			sizeM := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("M").
+				SetAttribute(size))
+			engraving := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+				SetName("Engraving").
+				SetCreateVariantMode("never"))
+			engravingYes := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("Yes").
+				SetAttribute(engraving))
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Sofa").
+				SetListPrice(100).
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit).
+				CreateAttributeLines(
+					h.ProductAttributeLine().NewData().
+						SetAttribute(size).
+						SetValues(sizeS.Union(sizeM))).
+				CreateAttributeLines(
+					h.ProductAttributeLine().NewData().
+						SetAttribute(engraving).
+						SetValues(engravingYes)))
+			h.ProductAttributePrice().Create(env, h.ProductAttributePrice().NewData().
+				SetProductTmpl(template).
+				SetValue(sizeM).
+				SetPriceExtra(20))
+			h.ProductAttributePrice().Create(env, h.ProductAttributePrice().NewData().
+				SetProductTmpl(template).
+				SetValue(engravingYes).
+				SetPriceExtra(5))
+			noPricelist := h.ProductPricelist().NewSet(env)
+			noPartner := h.Partner().NewSet(env)
+			Convey("Invalid selections are reported", func() {
+				config := template.ConfigureVariant(engravingYes, noPricelist, 1, noPartner)
+				So(config.Valid, ShouldBeFalse)
+				So(config.Errors, ShouldHaveLength, 1)
+				config = template.ConfigureVariant(sizeS.Union(sizeM), noPricelist, 1, noPartner)
+				So(config.Valid, ShouldBeFalse)
+				config = template.ConfigureVariant(sizeS.Union(ptd.prodAttr1V1), noPricelist, 1, noPartner)
+				So(config.Valid, ShouldBeFalse)
+				So(config.ProductID, ShouldEqual, 0)
+			})
+			Convey("Would-be variants are priced without being created", func() {
+				config := template.ConfigureVariant(sizeM.Union(engravingYes), noPricelist, 1, noPartner)
+				So(config.Valid, ShouldBeTrue)
+				So(config.ProductID, ShouldEqual, 0)
+				So(config.Available, ShouldBeTrue)
+				So(config.ListPrice, ShouldEqual, 100)
+				So(config.PriceExtra, ShouldEqual, 25)
+				So(config.Price, ShouldEqual, 125)
+				So(config.HasPricelistPrice, ShouldBeFalse)
+				So(template.ProductVariants().IsEmpty(), ShouldBeTrue)
+			})
+			Convey("Existing variants are matched", func() {
+				variant := template.GetOrCreateVariant(sizeS)
+				config := template.ConfigureVariant(sizeS.Union(engravingYes), noPricelist, 1, noPartner)
+				So(config.ProductID, ShouldEqual, variant.ID())
+				So(config.Price, ShouldEqual, 105)
+			})
+			Convey("Prices are computed with the given pricelist", func() {
+				variant := template.GetOrCreateVariant(sizeS)
+				pricelist := h.ProductPricelist().Create(env, h.ProductPricelist().NewData().
+					SetName("Configurator pricelist"))
+				h.ProductPricelistItem().Create(env, h.ProductPricelistItem().NewData().
+					SetPricelist(pricelist).
+					SetComputePrice("fixed").
+					SetFixedPrice(1).
+					SetProduct(variant).
+					SetAppliedOn("0_product_variant"))
+				h.ProductPricelistItem().Create(env, h.ProductPricelistItem().NewData().
+					SetPricelist(pricelist).
+					SetComputePrice("percentage").
+					SetPercentPrice(10).
+					SetProductTmpl(template).
+					SetAppliedOn("1_product"))
+				config := template.ConfigureVariant(sizeS, pricelist, 1, noPartner)
+				So(config.HasPricelistPrice, ShouldBeTrue)
+				So(config.PricelistPrice, ShouldEqual, 1)
+				// The rule of the existing variant does not apply to the would-be variant
+				config = template.ConfigureVariant(sizeM.Union(engravingYes), pricelist, 1, noPartner)
+				So(config.ProductID, ShouldEqual, 0)
+				So(config.HasPricelistPrice, ShouldBeTrue)
+				So(config.PricelistPrice, ShouldAlmostEqual, 112.5)
+				So(template.ProductVariants().Len(), ShouldEqual, 1)
+			})
+			Convey("Combination prices do not apply to kit components", func() {
+				template.GetOrCreateVariant(sizeS)
+				cushion := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Cushion").
+					SetListPrice(30).
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit))
+				template.SetIsKit(true)
+				h.ProductKitLine().Create(env, h.ProductKitLine().NewData().
+					SetKitTmpl(template).
+					SetProduct(cushion.ProductVariant()).
+					SetQuantity(2))
+				pricelist := h.ProductPricelist().Create(env, h.ProductPricelist().NewData().
+					SetName("Kit configurator pricelist"))
+				h.ProductPricelistItem().Create(env, h.ProductPricelistItem().NewData().
+					SetPricelist(pricelist).
+					SetComputePrice("percentage").
+					SetPercentPrice(50).
+					SetProductTmpl(cushion).
+					SetAppliedOn("1_product"))
+				h.ProductPricelistItem().Create(env, h.ProductPricelistItem().NewData().
+					SetPricelist(pricelist).
+					SetComputePrice("formula").
+					SetBase("kit").
+					SetProductTmpl(template).
+					SetAppliedOn("1_product"))
+				price, ok := template.GetCombinationPricelistPrice(sizeS.Union(engravingYes), pricelist, 1, noPartner)
+				So(ok, ShouldBeTrue)
+				So(price, ShouldAlmostEqual, 30)
+			})
+		}), ShouldBeNil)
+	})
+}
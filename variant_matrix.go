@@ -0,0 +1,189 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/fields"
+	"github.com/gleke/hexya/src/models/types"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/product/producttypes"
+)
+
+var fields_ProductTemplateVariantMatrix = map[string]models.FieldDefinition{
+	"VariantSummary": fields.Selection{String: "Variant Values Display", Selection: types.Selection{
+		"single":  "Single Variant Only",
+		"average": "Average",
+		"range":   "Range",
+	}, Required: true, Default: models.DefaultValue("single"),
+		Help: `How the weight, volume and cost of a product with several variants are displayed:
+Single Variant Only: they are only displayed for products with a single variant.
+Average: the average of the variants is displayed.
+Range: the minimum and maximum of the variants are displayed.`},
+	"WeightRange": fields.Char{String: "Weight Range",
+		Compute: h.ProductTemplate().Methods().ComputeVariantRanges(),
+		Depends: []string{"ProductVariants", "ProductVariants.Weight"}},
+	"VolumeRange": fields.Char{String: "Volume Range",
+		Compute: h.ProductTemplate().Methods().ComputeVariantRanges(),
+		Depends: []string{"ProductVariants", "ProductVariants.Volume"}},
+	"StandardPriceRange": fields.Char{String: "Cost Range",
+		Compute: h.ProductTemplate().Methods().ComputeVariantRanges(),
+		Depends: []string{"ProductVariants", "ProductVariants.StandardPrice"}},
+}
+
+// variantValueRange returns the range of the value returned by the given function
+// over the given variants.
+func variantValueRange(variants m.ProductProductSet, value func(m.ProductProductSet) float64) producttypes.ValueRange {
+	var res producttypes.ValueRange
+	if variants.IsEmpty() {
+		return res
+	}
+	res.Min, res.Max = math.Inf(1), math.Inf(-1)
+	for _, variant := range variants.Records() {
+		val := value(variant)
+		res.Min = math.Min(res.Min, val)
+		res.Max = math.Max(res.Max, val)
+		res.Average += val
+	}
+	res.Average /= float64(variants.Len())
+	return res
+}
+
+// formatValueRange returns the given range as displayed on templates
+func formatValueRange(r producttypes.ValueRange) string {
+	low := strconv.FormatFloat(r.Min, 'f', -1, 64)
+	if r.Min == r.Max {
+		return low
+	}
+	return fmt.Sprintf("%s - %s", low, strconv.FormatFloat(r.Max, 'f', -1, 64))
+}
+
+// variantWeight returns the weight of the given variant in the weight UoM of the company
+func variantWeight(variant m.ProductProductSet) float64 {
+	refUom := h.ProductUom().NewSet(variant.Env()).GetReferenceWeightUom()
+	return refUom.ComputeQuantity(variant.Weight(), variant.ProductTmpl().GetWeightUom(), false)
+}
+
+// variantVolume returns the volume of the given variant in the volume UoM of the company
+func variantVolume(variant m.ProductProductSet) float64 {
+	refUom := h.ProductUom().NewSet(variant.Env()).GetReferenceVolumeUom()
+	return refUom.ComputeQuantity(variant.Volume(), variant.ProductTmpl().GetVolumeUom(), false)
+}
+
+// variantStandardPrice returns the cost of the given variant
+func variantStandardPrice(variant m.ProductProductSet) float64 {
+	return variant.StandardPrice()
+}
+
+//`ComputeVariantRanges computes the ranges of the weights, volumes and costs of the variants of this template`,
+func product_template_ComputeVariantRanges(rs m.ProductTemplateSet) m.ProductTemplateData {
+	variants := rs.ProductVariants()
+	res := h.ProductTemplate().NewData()
+	if variants.IsEmpty() {
+		return res
+	}
+	return res.
+		SetWeightRange(formatValueRange(variantValueRange(variants, variantWeight))).
+		SetVolumeRange(formatValueRange(variantValueRange(variants, variantVolume))).
+		SetStandardPriceRange(formatValueRange(variantValueRange(variants, variantStandardPrice)))
+}
+
+//`GetVariantMatrix returns the weight, volume, cost, barcode and internal reference of each
+//		active variant of this template, with a summary of the numeric values. Weights and volumes
+//		are expressed in the UoMs of the company.`,
+func product_template_GetVariantMatrix(rs m.ProductTemplateSet) producttypes.VariantMatrix {
+	rs.EnsureOne()
+	variants := rs.ProductVariants().Sorted(func(rs1, rs2 m.ProductProductSet) bool {
+		return rs1.ID() < rs2.ID()
+	})
+	res := producttypes.VariantMatrix{
+		TemplateID:    rs.ID(),
+		WeightUom:     rs.GetWeightUom().Name(),
+		VolumeUom:     rs.GetVolumeUom().Name(),
+		Rows:          []producttypes.VariantMatrixRow{},
+		Weight:        variantValueRange(variants, variantWeight),
+		Volume:        variantValueRange(variants, variantVolume),
+		StandardPrice: variantValueRange(variants, variantStandardPrice),
+	}
+	for _, variant := range variants.Records() {
+		res.Rows = append(res.Rows, producttypes.VariantMatrixRow{
+			ProductID:     variant.ID(),
+			Name:          productVariantName(variant),
+			Weight:        variantWeight(variant),
+			Volume:        variantVolume(variant),
+			StandardPrice: variant.StandardPrice(),
+			Barcode:       variant.Barcode(),
+			DefaultCode:   variant.DefaultCode(),
+		})
+	}
+	return res
+}
+
+//`SetVariantMatrix writes the weight, volume, cost, barcode and internal reference of the
+//		variants of this template given in the rows. Weights and volumes are expressed in the UoMs
+//		of the company. Barcodes and internal references may be exchanged between variants, as
+//		their uniqueness is only checked once all the rows are written. It panics if a row refers
+//		to a variant of another template.`,
+func product_template_SetVariantMatrix(rs m.ProductTemplateSet, rows []producttypes.VariantMatrixRow) {
+	rs.EnsureOne()
+	allVariants := rs.WithContext("active_test", false).ProductVariants()
+	refWeightUom := h.ProductUom().NewSet(rs.Env()).GetReferenceWeightUom()
+	refVolumeUom := h.ProductUom().NewSet(rs.Env()).GetReferenceVolumeUom()
+	variants := make([]m.ProductProductSet, len(rows))
+	for i, row := range rows {
+		variants[i] = allVariants.Filtered(func(r m.ProductProductSet) bool {
+			return r.ID() == row.ProductID
+		})
+		if variants[i].IsEmpty() {
+			log.Panic(rs.T("Error: The product %d is not a variant of %s.", row.ProductID, rs.Name()))
+		}
+	}
+	// Clear the changed barcodes and references first, so that the uniqueness
+	// checks only see the final values.
+	for i, row := range rows {
+		data := h.ProductProduct().NewData()
+		if row.Barcode != variants[i].Barcode() && variants[i].Barcode() != "" {
+			data.SetBarcode("")
+		}
+		if row.DefaultCode != variants[i].DefaultCode() && variants[i].DefaultCode() != "" {
+			data.SetDefaultCode("")
+		}
+		if data.HasBarcode() || data.HasDefaultCode() {
+			variants[i].Write(data)
+		}
+	}
+	for i, row := range rows {
+		variant := variants[i]
+		data := h.ProductProduct().NewData()
+		if row.Weight != variantWeight(variant) {
+			data.SetWeight(rs.GetWeightUom().ComputeQuantity(row.Weight, refWeightUom, false))
+		}
+		if row.Volume != variantVolume(variant) {
+			data.SetVolume(rs.GetVolumeUom().ComputeQuantity(row.Volume, refVolumeUom, false))
+		}
+		if row.StandardPrice != variant.StandardPrice() {
+			data.SetStandardPrice(row.StandardPrice)
+		}
+		if row.Barcode != variant.Barcode() {
+			data.SetBarcode(row.Barcode)
+		}
+		if row.DefaultCode != variant.DefaultCode() {
+			data.SetDefaultCode(row.DefaultCode)
+		}
+		variant.Write(data)
+	}
+}
+
+func init() {
+	h.ProductTemplate().AddFields(fields_ProductTemplateVariantMatrix)
+	h.ProductTemplate().NewMethod("ComputeVariantRanges", product_template_ComputeVariantRanges)
+	h.ProductTemplate().NewMethod("GetVariantMatrix", product_template_GetVariantMatrix)
+	h.ProductTemplate().NewMethod("SetVariantMatrix", product_template_SetVariantMatrix)
+}
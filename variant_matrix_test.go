@@ -0,0 +1,84 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/product/producttypes"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVariantMatrix(t *testing.T) {
+	Convey("Testing the variant matrix editor", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Crate").
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit).
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(ptd.prodAtt1).
+					SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))))
+			matrix := template.GetVariantMatrix()
+			So(matrix.Rows, ShouldHaveLength, 2)
+			matrix.Rows[0].Weight = 1
+			matrix.Rows[0].StandardPrice = 10
+			matrix.Rows[0].DefaultCode = "CRATE-1"
+			matrix.Rows[1].Weight = 3
+			matrix.Rows[1].StandardPrice = 20
+			matrix.Rows[1].Barcode = "4006381333931"
+			template.SetVariantMatrix(matrix.Rows)
+			Convey("Variant values are written in one call", func() {
+				first := h.ProductProduct().Browse(env, []int64{matrix.Rows[0].ProductID})
+				second := h.ProductProduct().Browse(env, []int64{matrix.Rows[1].ProductID})
+				So(first.DefaultCode(), ShouldEqual, "CRATE-1")
+				So(first.StandardPrice(), ShouldEqual, 10)
+				So(second.Barcode(), ShouldEqual, "4006381333931")
+				matrix = template.GetVariantMatrix()
+				So(matrix.Weight.Min, ShouldEqual, 1)
+				So(matrix.Weight.Max, ShouldEqual, 3)
+				So(matrix.StandardPrice.Average, ShouldEqual, 15)
+			})
+			Convey("Barcodes and references can be swapped between variants", func() {
+				matrix = template.GetVariantMatrix()
+				matrix.Rows[0].Barcode, matrix.Rows[1].Barcode = matrix.Rows[1].Barcode, matrix.Rows[0].Barcode
+				matrix.Rows[0].DefaultCode, matrix.Rows[1].DefaultCode = matrix.Rows[1].DefaultCode, matrix.Rows[0].DefaultCode
+				So(func() { template.SetVariantMatrix(matrix.Rows) }, ShouldNotPanic)
+				first := h.ProductProduct().Browse(env, []int64{matrix.Rows[0].ProductID})
+				second := h.ProductProduct().Browse(env, []int64{matrix.Rows[1].ProductID})
+				So(first.Barcode(), ShouldEqual, "4006381333931")
+				So(second.DefaultCode(), ShouldEqual, "CRATE-1")
+			})
+			Convey("Values set on the template apply to all its variants", func() {
+				template.SetStandardPrice(12)
+				template.SetWeight(2)
+				for _, variant := range template.ProductVariants().Records() {
+					So(variant.StandardPrice(), ShouldEqual, 12)
+					So(variant.Weight(), ShouldEqual, 2)
+				}
+			})
+			Convey("Template values are averages or ranges of the variants", func() {
+				So(template.Weight(), ShouldEqual, 0)
+				template.SetVariantSummary("average")
+				So(template.Weight(), ShouldEqual, 2)
+				So(template.StandardPrice(), ShouldEqual, 15)
+				So(template.WeightRange(), ShouldEqual, "1 - 3")
+				So(template.StandardPriceRange(), ShouldEqual, "10 - 20")
+			})
+			Convey("Only variants of the template can be edited", func() {
+				other := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Lid").
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit))
+				So(func() {
+					template.SetVariantMatrix([]producttypes.VariantMatrixRow{{ProductID: other.ProductVariant().ID()}})
+				}, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
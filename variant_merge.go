@@ -0,0 +1,75 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"log"
+
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/m"
+	"github.com/gleke/pool/q"
+	"github.com/gleke/product/producttypes"
+)
+
+//`FindDuplicateVariants returns the groups of active variants of the templates of this set
+//		that have the same attribute values.`,
+func product_template_FindDuplicateVariants(rs m.ProductTemplateSet) []producttypes.DuplicateVariants {
+	return duplicateVariants(rs)
+}
+
+//`MergeDuplicateVariants merges the duplicate variants of the templates of this set, as found by
+//		FindDuplicateVariants, into the oldest variant of each group. It returns the number of
+//		archived variants.`,
+func product_template_MergeDuplicateVariants(rs m.ProductTemplateSet) int {
+	var count int
+	for _, duplicate := range rs.FindDuplicateVariants() {
+		target := h.ProductProduct().Browse(rs.Env(), duplicate.ProductIDs[:1])
+		h.ProductProduct().Browse(rs.Env(), duplicate.ProductIDs[1:]).MergeInto(target)
+		count += len(duplicate.ProductIDs) - 1
+	}
+	return count
+}
+
+//`MoveVariantReferences moves the records referencing the variants of this set to the given target
+//		variant. It moves supplier prices, pricelist items and cost history. Modules defining other
+//		records referencing variants should extend this method to move them too.`,
+func product_product_MoveVariantReferences(rs m.ProductProductSet, target m.ProductProductSet) {
+	h.ProductSupplierinfo().Search(rs.Env(), q.ProductSupplierinfo().Product().In(rs)).
+		SetProduct(target)
+	h.ProductPricelistItem().Search(rs.Env(), q.ProductPricelistItem().Product().In(rs)).
+		SetProduct(target)
+	h.ProductPriceHistory().Search(rs.Env(), q.ProductPriceHistory().Product().In(rs)).
+		SetProduct(target)
+}
+
+//`MergeInto moves the references to the variants of this set to the given target variant with
+//		MoveVariantReferences, then archives them. It panics if a variant of this set does not
+//		belong to the template of the target or has other attribute values.`,
+func product_product_MergeInto(rs m.ProductProductSet, target m.ProductProductSet) {
+	target.EnsureOne()
+	variants := rs.Subtract(target)
+	if variants.IsEmpty() {
+		return
+	}
+	for _, variant := range variants.Records() {
+		if !variant.ProductTmpl().Equals(target.ProductTmpl()) ||
+			!variant.AttributeValues().Equals(target.AttributeValues()) {
+			log.Panic(rs.T("Error: The variant %s cannot be merged into %s as they are not duplicates.",
+				variant.NameGet(), target.NameGet()))
+		}
+	}
+	variants.MoveVariantReferences(target)
+	variants.SetActive(false)
+	if !target.Active() {
+		target.SetActive(true)
+	}
+}
+
+func init() {
+	h.ProductTemplate().NewMethod("FindDuplicateVariants", product_template_FindDuplicateVariants)
+	h.ProductTemplate().NewMethod("MergeDuplicateVariants", product_template_MergeDuplicateVariants)
+
+	h.ProductProduct().NewMethod("MoveVariantReferences", product_product_MoveVariantReferences)
+	h.ProductProduct().NewMethod("MergeInto", product_product_MergeInto)
+}
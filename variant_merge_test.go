@@ -0,0 +1,69 @@
+// Copyright 2020 NDP Systèmes. All Rights Reserved.
+// See LICENSE file for full licensing details.
+
+package product
+
+import (
+	"testing"
+
+	"github.com/gleke/hexya/src/models"
+	"github.com/gleke/hexya/src/models/security"
+	"github.com/gleke/pool/h"
+	"github.com/gleke/pool/q"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVariantsMerge(t *testing.T) {
+	Convey("Testing duplicate variants detection and merge", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Stool").
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit).
+				CreateAttributeLines(h.ProductAttributeLine().NewData().
+					SetAttribute(ptd.prodAtt1).
+					SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))))
+			original := template.FindVariant(ptd.prodAttr1V1)
+			duplicate := h.ProductProduct().Create(env, h.ProductProduct().NewData().
+				SetProductTmpl(template).
+				SetAttributeValues(ptd.prodAttr1V1))
+			supplier := h.Partner().Create(env, h.Partner().NewData().SetName("Stool Factory"))
+			seller := h.ProductSupplierinfo().Create(env, h.ProductSupplierinfo().NewData().
+				SetName(supplier).
+				SetProductTmpl(template).
+				SetProduct(duplicate))
+			pricelist := h.ProductPricelist().Create(env, h.ProductPricelist().NewData().
+				SetName("Stool pricelist"))
+			item := h.ProductPricelistItem().Create(env, h.ProductPricelistItem().NewData().
+				SetPricelist(pricelist).
+				SetComputePrice("fixed").
+				SetFixedPrice(10).
+				SetProduct(duplicate).
+				SetAppliedOn("0_product_variant"))
+			duplicate.SetStandardPrice(7)
+			history := h.ProductPriceHistory().Search(env, q.ProductPriceHistory().Product().Equals(duplicate))
+			Convey("Duplicate variants are detected", func() {
+				duplicates := template.FindDuplicateVariants()
+				So(duplicates, ShouldHaveLength, 1)
+				So(duplicates[0].TemplateID, ShouldEqual, template.ID())
+				So(duplicates[0].ProductIDs, ShouldResemble, []int64{original.ID(), duplicate.ID()})
+			})
+			Convey("Merged variants are archived and their references moved", func() {
+				So(template.MergeDuplicateVariants(), ShouldEqual, 1)
+				So(duplicate.Active(), ShouldBeFalse)
+				So(original.Active(), ShouldBeTrue)
+				So(seller.Product().Equals(original), ShouldBeTrue)
+				So(item.Product().Equals(original), ShouldBeTrue)
+				So(history.Len(), ShouldEqual, 1)
+				So(history.Product().Equals(original), ShouldBeTrue)
+				So(history.Cost(), ShouldEqual, 7)
+				So(template.FindDuplicateVariants(), ShouldBeEmpty)
+			})
+			Convey("Only duplicates can be merged", func() {
+				other := template.FindVariant(ptd.prodAttr1V2)
+				So(func() { other.MergeInto(original) }, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
@@ -4,6 +4,7 @@
 package product
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/gleke/hexya/src/models"
@@ -341,3 +342,276 @@ func TestVariantsNoCreate(t *testing.T) {
 		}), ShouldBeNil)
 	})
 }
+
+func TestVariantsExclusions(t *testing.T) {
+	Convey("Testing variants with excluded combinations", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			sizeAttr := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().SetName("Size"))
+			sizeAttreValueS := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("S").
+				SetAttribute(sizeAttr))
+			sizeAttreValueM := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("M").
+				SetAttribute(sizeAttr))
+			sizeAttreValueL := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("L").
+				SetAttribute(sizeAttr))
+			ptd := getProductTestData(env)
+			hasCombination := func(template m.ProductTemplateSet, values m.ProductAttributeValueSet) bool {
+				for _, variant := range template.ProductVariants().Records() {
+					if variant.AttributeValues().Equals(values) {
+						return true
+					}
+				}
+				return false
+			}
+			Convey("Excluded combinations are not created", func() {
+				testTemplate := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Sofa").
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit).
+					CreateAttributeLines(
+						h.ProductAttributeLine().NewData().
+							SetAttribute(sizeAttr).
+							SetValues(sizeAttreValueS.Union(sizeAttreValueM).Union(sizeAttreValueL))).
+					CreateAttributeLines(
+						h.ProductAttributeLine().NewData().
+							SetAttribute(ptd.prodAtt1).
+							SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))).
+					CreateAttributeExclusions(
+						h.ProductAttributeExclusion().NewData().
+							SetValue(sizeAttreValueS).
+							SetExcludedValues(ptd.prodAttr1V2)))
+				So(testTemplate.ProductVariants().Len(), ShouldEqual, 5)
+				So(hasCombination(testTemplate, sizeAttreValueS.Union(ptd.prodAttr1V1)), ShouldBeTrue)
+				So(hasCombination(testTemplate, sizeAttreValueS.Union(ptd.prodAttr1V2)), ShouldBeFalse)
+				So(testTemplate.IsCombinationPossible(ptd.prodAttr1V2.Union(sizeAttreValueS)), ShouldBeFalse)
+				So(testTemplate.IsCombinationPossible(ptd.prodAttr1V2.Union(sizeAttreValueM)), ShouldBeTrue)
+			})
+			Convey("Adding and removing exclusions updates existing variants", func() {
+				testTemplate := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Sofa").
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit).
+					CreateAttributeLines(
+						h.ProductAttributeLine().NewData().
+							SetAttribute(sizeAttr).
+							SetValues(sizeAttreValueS.Union(sizeAttreValueM).Union(sizeAttreValueL))).
+					CreateAttributeLines(
+						h.ProductAttributeLine().NewData().
+							SetAttribute(ptd.prodAtt1).
+							SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))))
+				So(testTemplate.ProductVariants().Len(), ShouldEqual, 6)
+				exclusion := h.ProductAttributeExclusion().Create(env, h.ProductAttributeExclusion().NewData().
+					SetProductTmpl(testTemplate).
+					SetValue(ptd.prodAttr1V1).
+					SetExcludedValues(sizeAttreValueM.Union(sizeAttreValueL)))
+				So(testTemplate.ProductVariants().Len(), ShouldEqual, 4)
+				So(hasCombination(testTemplate, sizeAttreValueS.Union(ptd.prodAttr1V1)), ShouldBeTrue)
+				So(hasCombination(testTemplate, sizeAttreValueM.Union(ptd.prodAttr1V1)), ShouldBeFalse)
+				So(hasCombination(testTemplate, sizeAttreValueL.Union(ptd.prodAttr1V1)), ShouldBeFalse)
+				exclusion.SetExcludedValues(sizeAttreValueL)
+				So(testTemplate.ProductVariants().Len(), ShouldEqual, 5)
+				So(hasCombination(testTemplate, sizeAttreValueM.Union(ptd.prodAttr1V1)), ShouldBeTrue)
+				exclusion.Unlink()
+				So(testTemplate.ProductVariants().Len(), ShouldEqual, 6)
+			})
+			Convey("Values of the same attribute cannot exclude each other", func() {
+				testTemplate := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Sofa").
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit))
+				So(func() {
+					h.ProductAttributeExclusion().Create(env, h.ProductAttributeExclusion().NewData().
+						SetProductTmpl(testTemplate).
+						SetValue(sizeAttreValueS).
+						SetExcludedValues(sizeAttreValueM))
+				}, ShouldPanic)
+			})
+		}), ShouldBeNil)
+	})
+}
+
+func TestVariantsDynamic(t *testing.T) {
+	Convey("Testing dynamically created variants", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			size := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+				SetName("Size").
+				SetCreateVariantMode("dynamic"))
+			sizeS := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("S").
+				SetAttribute(size))
+			sizeM := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("M").
+				SetAttribute(size))
+			engraving := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+				SetName("Engraving").
+				SetCreateVariantMode("never"))
+			engravingYes := h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+				SetName("Yes").
+				SetAttribute(engraving))
+			ptd := getProductTestData(env)
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+				SetName("Sofa").
+				SetListPrice(100).
+				SetUom(ptd.uomUnit).
+				SetUomPo(ptd.uomUnit).
+				CreateAttributeLines(
+					h.ProductAttributeLine().NewData().
+						SetAttribute(size).
+						SetValues(sizeS.Union(sizeM))).
+				CreateAttributeLines(
+					h.ProductAttributeLine().NewData().
+						SetAttribute(ptd.prodAtt1).
+						SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))).
+				CreateAttributeLines(
+					h.ProductAttributeLine().NewData().
+						SetAttribute(engraving).
+						SetValues(engravingYes)))
+			Convey("Create variant modes map to the CreateVariant flag", func() {
+				So(size.CreateVariant(), ShouldBeTrue)
+				So(engraving.CreateVariant(), ShouldBeFalse)
+				engraving.SetCreateVariant(true)
+				So(engraving.CreateVariantMode(), ShouldEqual, "always")
+				size.SetCreateVariant(false)
+				So(size.CreateVariantMode(), ShouldEqual, "never")
+			})
+			Convey("No variant is created up front", func() {
+				So(template.ProductVariants().IsEmpty(), ShouldBeTrue)
+				So(template.HasDynamicAttributes(), ShouldBeTrue)
+			})
+			Convey("Variants are created when requested", func() {
+				variant := template.GetOrCreateVariant(sizeS.Union(ptd.prodAttr1V2).Union(engravingYes))
+				So(variant.AttributeValues().Equals(sizeS.Union(ptd.prodAttr1V2)), ShouldBeTrue)
+				So(template.ProductVariants().Len(), ShouldEqual, 1)
+				So(template.GetOrCreateVariant(sizeS.Union(ptd.prodAttr1V2)).Equals(variant), ShouldBeTrue)
+				So(template.ProductVariants().Len(), ShouldEqual, 1)
+				template.GetOrCreateVariant(sizeM.Union(ptd.prodAttr1V2))
+				So(template.ProductVariants().Len(), ShouldEqual, 2)
+				// Updating the template keeps requested variants
+				template.SetAttributeLines(template.AttributeLines())
+				So(template.ProductVariants().Len(), ShouldEqual, 2)
+			})
+			Convey("Invalid combinations are refused", func() {
+				So(func() { template.GetOrCreateVariant(sizeS) }, ShouldPanic)
+				So(func() { template.GetOrCreateVariant(sizeS.Union(sizeM).Union(ptd.prodAttr1V1)) }, ShouldPanic)
+				h.ProductAttributeExclusion().Create(env, h.ProductAttributeExclusion().NewData().
+					SetProductTmpl(template).
+					SetValue(sizeM).
+					SetExcludedValues(ptd.prodAttr1V1))
+				So(func() { template.GetOrCreateVariant(sizeM.Union(ptd.prodAttr1V1)) }, ShouldPanic)
+			})
+			Convey("Combinations are priced without being created", func() {
+				h.ProductAttributePrice().Create(env, h.ProductAttributePrice().NewData().
+					SetProductTmpl(template).
+					SetValue(sizeM).
+					SetPriceExtra(20))
+				h.ProductAttributePrice().Create(env, h.ProductAttributePrice().NewData().
+					SetProductTmpl(template).
+					SetValue(engravingYes).
+					SetPriceExtra(5))
+				So(template.GetCombinationPrice(sizeM.Union(ptd.prodAttr1V1).Union(engravingYes)), ShouldEqual, 125)
+				So(template.GetCombinationPrice(sizeS.Union(ptd.prodAttr1V1)), ShouldEqual, 100)
+				So(template.ProductVariants().IsEmpty(), ShouldBeTrue)
+				variant := template.GetOrCreateVariant(sizeM.Union(ptd.prodAttr1V1))
+				So(variant.LstPrice(), ShouldEqual, 120)
+			})
+		}), ShouldBeNil)
+	})
+}
+
+func TestVariantsLimit(t *testing.T) {
+	Convey("Testing the variant limit", t, func() {
+		So(models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			ptd := getProductTestData(env)
+			size := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().SetName("Size"))
+			for _, name := range []string{"S", "M", "L"} {
+				h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+					SetName(name).
+					SetAttribute(size))
+			}
+			company := h.Company().NewSet(env).CompanyDefaultGet()
+			company.SetVariantLimit(5)
+			newTemplate := func() m.ProductTemplateSet {
+				return h.ProductTemplate().Create(env, h.ProductTemplate().NewData().
+					SetName("Sofa").
+					SetUom(ptd.uomUnit).
+					SetUomPo(ptd.uomUnit).
+					CreateAttributeLines(
+						h.ProductAttributeLine().NewData().
+							SetAttribute(size).
+							SetValues(size.Values())).
+					CreateAttributeLines(
+						h.ProductAttributeLine().NewData().
+							SetAttribute(ptd.prodAtt1).
+							SetValues(ptd.prodAttr1V1.Union(ptd.prodAttr1V2))))
+			}
+			Convey("Generating more variants than the limit is refused", func() {
+				So(func() { newTemplate() }, ShouldPanic)
+			})
+			Convey("Exclusions are taken into account", func() {
+				company.SetVariantLimit(6)
+				template := newTemplate()
+				So(template.ProductVariants().Len(), ShouldEqual, 6)
+				company.SetVariantLimit(5)
+				So(func() { template.SetAttributeLines(template.AttributeLines()) }, ShouldPanic)
+				template.Write(h.ProductTemplate().NewData().
+					CreateAttributeExclusions(h.ProductAttributeExclusion().NewData().
+						SetValue(ptd.prodAttr1V1).
+						SetExcludedValues(size.Values().Records()[0])))
+				So(template.ProductVariants().Len(), ShouldEqual, 5)
+			})
+			Convey("A zero limit allows any number of variants", func() {
+				company.SetVariantLimit(0)
+				So(newTemplate().ProductVariants().Len(), ShouldEqual, 6)
+			})
+		}), ShouldBeNil)
+	})
+}
+
+// benchmarkCreateVariants creates a template with a matrix of the given sizes
+func benchmarkCreateVariants(b *testing.B, sizes ...int) {
+	for i := 0; i < b.N; i++ {
+		err := models.SimulateInNewEnvironment(security.SuperUserID, func(env models.Environment) {
+			h.Company().NewSet(env).CompanyDefaultGet().SetVariantLimit(0)
+			template := h.ProductTemplate().Create(env, h.ProductTemplate().NewData().SetName("Benchmark"))
+			for j, size := range sizes {
+				attr := h.ProductAttribute().Create(env, h.ProductAttribute().NewData().
+					SetName(fmt.Sprintf("Attribute %d", j)))
+				values := h.ProductAttributeValue().NewSet(env)
+				for k := 0; k < size; k++ {
+					values = values.Union(h.ProductAttributeValue().Create(env, h.ProductAttributeValue().NewData().
+						SetName(fmt.Sprintf("Value %d", k)).
+						SetAttribute(attr)))
+				}
+				h.ProductAttributeLine().Create(env, h.ProductAttributeLine().NewData().
+					SetProductTmpl(template).
+					SetAttribute(attr).
+					SetValues(values))
+			}
+			b.StartTimer()
+			template.CreateVariants()
+			// Saving again must not recreate anything
+			template.CreateVariants()
+			b.StopTimer()
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCreateVariants100(b *testing.B) {
+	b.StopTimer()
+	benchmarkCreateVariants(b, 10, 10)
+}
+
+func BenchmarkCreateVariants1000(b *testing.B) {
+	b.StopTimer()
+	benchmarkCreateVariants(b, 10, 10, 10)
+}
+
+func BenchmarkCreateVariantsManyValues(b *testing.B) {
+	b.StopTimer()
+	benchmarkCreateVariants(b, 2000)
+}